@@ -0,0 +1,475 @@
+package qp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maskedValue replaces secrets in printed configuration
+const maskedValue = "******"
+
+var (
+	// variablePattern - ${NAME} or ${NAME:-default}, $${ is written as is
+	variablePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+	// secretPattern - options with these words in the name are masked in printed configuration
+	secretPattern = regexp.MustCompile(`(?i)password|passwd|secret|token|credential|apikey|api_key|authorization|private`)
+)
+
+// readConfigTree reads configuration file (YAML, JSON or TOML), interpolates environment variables and merges included files.
+// Files listed in `include` are merged first (in order), the including file is merged on top of them
+func readConfigTree(path string, including []string) (map[interface{}]interface{}, error) {
+	for _, parent := range including {
+		if parent == path {
+			return nil, fmt.Errorf("Config file %s includes itself", path)
+		}
+	}
+
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parseConfig(path, source)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	interpolated, err := interpolate("", tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	tree = interpolated.(map[interface{}]interface{})
+
+	includes, ok := tree["include"]
+	delete(tree, "include")
+	if !ok || includes == nil {
+		return tree, nil
+	}
+	list, ok := includes.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: include should be a list of files", path)
+	}
+
+	merged := make(map[interface{}]interface{})
+	for _, include := range list {
+		includePath, ok := include.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: include should be a list of files", path)
+		}
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), includePath)
+		}
+		included, err := readConfigTree(includePath, append(including, path))
+		if err != nil {
+			return nil, err
+		}
+		merged = merge(merged, included).(map[interface{}]interface{})
+	}
+	return merge(merged, tree).(map[interface{}]interface{}), nil
+}
+
+// parseConfig parses configuration file of format detected by extension: .json, .toml, YAML otherwise
+func parseConfig(path string, source []byte) (map[interface{}]interface{}, error) {
+	var parsed interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(source))
+		decoder.UseNumber()
+		if err := decoder.Decode(&parsed); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		var document map[string]interface{}
+		if _, err := toml.Decode(string(source), &document); err != nil {
+			return nil, err
+		}
+		parsed = document
+	default:
+		if err := yaml.Unmarshal(source, &parsed); err != nil {
+			return nil, err
+		}
+	}
+
+	if parsed == nil {
+		return make(map[interface{}]interface{}), nil
+	}
+	tree, ok := normalize(parsed).(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("configuration should be a map")
+	}
+	return tree, nil
+}
+
+// normalize converts values parsed from JSON and TOML into values YAML parser produces
+func normalize(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		result := make(map[interface{}]interface{}, len(value))
+		for key, item := range value {
+			result[key] = normalize(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		for key, item := range value {
+			value[key] = normalize(item)
+		}
+		return value
+	case []map[string]interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = normalize(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalize(item)
+		}
+		return value
+	case json.Number:
+		if number, err := value.Int64(); err == nil {
+			return int(number)
+		}
+		number, _ := value.Float64()
+		return number
+	case int64:
+		return int(value)
+	}
+	return value
+}
+
+// merge merges override into base: maps are merged key by key, lists of named entries (queues, processors, etc)
+// are merged entry by entry (see mergeEntry), anything else is replaced
+func merge(base interface{}, override interface{}) interface{} {
+	switch override := override.(type) {
+	case map[interface{}]interface{}:
+		baseMap, ok := base.(map[interface{}]interface{})
+		if !ok {
+			return override
+		}
+		merged := make(map[interface{}]interface{}, len(baseMap))
+		for key, value := range baseMap {
+			merged[key] = value
+		}
+		for key, value := range override {
+			merged[key] = merge(merged[key], value)
+		}
+		return merged
+	case []interface{}:
+		baseList, ok := base.([]interface{})
+		if !ok || !isNamedList(baseList) || !isNamedList(override) {
+			return override
+		}
+		merged := append([]interface{}{}, baseList...)
+		for _, entry := range override {
+			name := entry.(map[interface{}]interface{})["name"]
+			found := false
+			for i, baseEntry := range merged {
+				if baseEntry.(map[interface{}]interface{})["name"] == name {
+					merged[i] = mergeEntry(baseEntry.(map[interface{}]interface{}), entry.(map[interface{}]interface{}))
+					found = true
+					break
+				}
+			}
+			if !found {
+				merged = append(merged, entry)
+			}
+		}
+		return merged
+	}
+	return override
+}
+
+// mergeEntry merges entries with the same name, entry of other type replaces the base one
+func mergeEntry(base map[interface{}]interface{}, override map[interface{}]interface{}) interface{} {
+	if entryType, ok := override["type"]; ok && entryType != base["type"] {
+		return override
+	}
+	return merge(base, override)
+}
+
+// isNamedList returns true if every entry of the list is a map with a name
+func isNamedList(list []interface{}) bool {
+	for _, entry := range list {
+		entryMap, ok := entry.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := entryMap["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// interpolate replaces ${NAME} and ${NAME:-default} in string values with environment variables.
+// Value consisting of one variable only takes its YAML type (e.g. number for "${THREADS:-4}")
+func interpolate(path string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		for key, item := range value {
+			interpolated, err := interpolate(joinConfigPath(path, fmt.Sprint(key)), item)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = interpolated
+		}
+	case []interface{}:
+		for i, item := range value {
+			interpolated, err := interpolate(fmt.Sprintf("%s[%d]", path, i), item)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = interpolated
+		}
+	case string:
+		return interpolateString(path, value)
+	}
+	return value, nil
+}
+
+func interpolateString(path string, value string) (interface{}, error) {
+	var missing []string
+	result := variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		groups := variablePattern.FindStringSubmatch(match)
+		if env, ok := os.LookupEnv(groups[1]); ok && (env != "" || groups[2] == "") {
+			return env
+		}
+		if groups[2] == "" {
+			missing = append(missing, groups[1])
+		}
+		return groups[3]
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: environment variable %s is not set", path, strings.Join(missing, ", "))
+	}
+
+	if result == value {
+		return value, nil
+	}
+	if match := variablePattern.FindString(value); match == value && !strings.HasPrefix(match, "$$") {
+		var typed interface{}
+		if err := yaml.Unmarshal([]byte(result), &typed); err == nil {
+			switch typed.(type) {
+			case int, float64, bool:
+				return typed, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// Set returns configuration override which sets value at path, e.g. "general.log.level=debug",
+// "queue[0].options.QueueName=orders" or "processor[Image resizer].options.URL=http://localhost/".
+// Entries of configuration sections are addressed by index or by name, value is parsed as YAML
+func Set(assignment string) (func(config *Config) error, error) {
+	parts := strings.SplitN(assignment, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("Wrong override %q, key=value expected", assignment)
+	}
+	keys, err := splitConfigPath(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(parts[1]), &value); err != nil {
+		return nil, fmt.Errorf("Wrong value of override %q: %s", assignment, err.Error())
+	}
+
+	return func(config *Config) error {
+		if err := setValue(reflect.ValueOf(config).Elem(), keys, parts[1], value); err != nil {
+			return fmt.Errorf("Can't set %s: %s", parts[0], err.Error())
+		}
+		return nil
+	}, nil
+}
+
+// splitConfigPath splits "processor[Image resizer].options.URL" into "processor", "[Image resizer]", "options", "URL"
+func splitConfigPath(path string) ([]string, error) {
+	var keys []string
+	for path != "" {
+		switch {
+		case path[0] == '[':
+			end := strings.Index(path, "]")
+			if end < 2 {
+				return nil, fmt.Errorf("Wrong override key %q", path)
+			}
+			keys = append(keys, path[:end+1])
+			path = path[end+1:]
+		case path[0] == '.':
+			path = path[1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			keys = append(keys, path[:end])
+			path = path[end:]
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("Wrong override key %q", path)
+	}
+	return keys, nil
+}
+
+// setValue sets value at keys of the configuration struct. Typed fields are parsed from source,
+// options get parsed value
+func setValue(target reflect.Value, keys []string, source string, value interface{}) error {
+	if len(keys) == 0 {
+		if target.Kind() == reflect.Interface {
+			target.Set(reflect.ValueOf(&value).Elem())
+			return nil
+		}
+		return yaml.Unmarshal([]byte(source), target.Addr().Interface())
+	}
+
+	key := keys[0]
+	switch target.Kind() {
+	case reflect.Struct:
+		for i := 0; i < target.NumField(); i++ {
+			field := target.Type().Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if strings.EqualFold(name, key) {
+				return setValue(target.Field(i), keys[1:], source, value)
+			}
+		}
+		return fmt.Errorf("unknown key %s", key)
+	case reflect.Slice:
+		if !strings.HasPrefix(key, "[") {
+			return fmt.Errorf("index or name expected, %s given", key)
+		}
+		index := strings.Trim(key, "[]")
+		if i, err := strconv.Atoi(index); err == nil {
+			if i < 0 || i >= target.Len() {
+				return fmt.Errorf("index %d out of range", i)
+			}
+			return setValue(target.Index(i), keys[1:], source, value)
+		}
+		for i := 0; i < target.Len(); i++ {
+			if entry := target.Index(i); entry.Kind() == reflect.Struct && entry.FieldByName("Name").String() == index {
+				return setValue(entry, keys[1:], source, value)
+			}
+		}
+		return fmt.Errorf("entry %s not found", index)
+	case reflect.Map:
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+		options, err := setOption(target.MapIndex(reflect.ValueOf(key)), keys[1:], value)
+		if err != nil {
+			return err
+		}
+		target.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(&options).Elem())
+		return nil
+	}
+	return fmt.Errorf("%s can't be set", key)
+}
+
+// setOption sets value at keys of generic options (as decoded from YAML) and returns updated options
+func setOption(options reflect.Value, keys []string, value interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	var current interface{}
+	if options.IsValid() {
+		current = options.Interface()
+	}
+
+	key := keys[0]
+	if strings.HasPrefix(key, "[") {
+		list, ok := current.([]interface{})
+		index, err := strconv.Atoi(strings.Trim(key, "[]"))
+		if !ok || err != nil || index < 0 || index >= len(list) {
+			return nil, fmt.Errorf("%s not found", key)
+		}
+		item, err := setOption(reflect.ValueOf(list[index]), keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[index] = item
+		return list, nil
+	}
+
+	optionsMap, ok := current.(map[interface{}]interface{})
+	if !ok {
+		if current != nil {
+			return nil, fmt.Errorf("%s is not a map", key)
+		}
+		optionsMap = make(map[interface{}]interface{})
+	}
+	item, err := setOption(reflect.ValueOf(optionsMap[key]), keys[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	optionsMap[key] = item
+	return optionsMap, nil
+}
+
+// DumpConfig returns configuration as YAML. Values of options which look like secrets (passwords, tokens, etc)
+// and passwords in URLs are masked
+func DumpConfig(config *Config) (string, error) {
+	source, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	var tree interface{}
+	if err := yaml.Unmarshal(source, &tree); err != nil {
+		return "", err
+	}
+	masked, err := yaml.Marshal(mask(tree))
+	if err != nil {
+		return "", err
+	}
+	return string(masked), nil
+}
+
+func mask(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		for key, item := range value {
+			if secretPattern.MatchString(fmt.Sprint(key)) && item != nil {
+				value[key] = maskedValue
+			} else {
+				value[key] = mask(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = mask(item)
+		}
+	case string:
+		if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+			if _, ok := parsed.User.Password(); ok {
+				return parsed.Redacted()
+			}
+		}
+	}
+	return value
+}
+
+func joinConfigPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,246 @@
+package qp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tree = map[interface{}]interface{}
+
+type list = []interface{}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     interface{}
+		override interface{}
+		expected interface{}
+	}{
+		{
+			name:     "maps are merged key by key",
+			base:     tree{"general": tree{"log": tree{"level": "warn", "format": "json"}}},
+			override: tree{"general": tree{"log": tree{"level": "debug"}}},
+			expected: tree{"general": tree{"log": tree{"level": "debug", "format": "json"}}},
+		},
+		{
+			name:     "scalar replaces map",
+			base:     tree{"options": tree{"a": 1}},
+			override: tree{"options": "none"},
+			expected: tree{"options": "none"},
+		},
+		{
+			name:     "map replaces scalar",
+			base:     tree{"options": "none"},
+			override: tree{"options": tree{"a": 1}},
+			expected: tree{"options": tree{"a": 1}},
+		},
+		{
+			name: "named entries are merged by name, new ones appended",
+			base: list{
+				tree{"name": "a", "type": "Shell", "options": tree{"Command": "x", "Timeout": 1}},
+				tree{"name": "b", "type": "Stdout"},
+			},
+			override: list{
+				tree{"name": "c", "type": "Stdout"},
+				tree{"name": "a", "options": tree{"Timeout": 2}},
+			},
+			expected: list{
+				tree{"name": "a", "type": "Shell", "options": tree{"Command": "x", "Timeout": 2}},
+				tree{"name": "b", "type": "Stdout"},
+				tree{"name": "c", "type": "Stdout"},
+			},
+		},
+		{
+			name:     "named entry of other type replaces base one",
+			base:     list{tree{"name": "a", "type": "Shell", "options": tree{"Command": "x"}}},
+			override: list{tree{"name": "a", "type": "HttpProxy", "options": tree{"URL": "http://localhost/"}}},
+			expected: list{tree{"name": "a", "type": "HttpProxy", "options": tree{"URL": "http://localhost/"}}},
+		},
+		{
+			name:     "named entry of the same type is merged",
+			base:     list{tree{"name": "a", "type": "Shell", "options": tree{"Command": "x"}}},
+			override: list{tree{"name": "a", "type": "Shell", "options": tree{"Timeout": 3}}},
+			expected: list{tree{"name": "a", "type": "Shell", "options": tree{"Command": "x", "Timeout": 3}}},
+		},
+		{
+			name:     "lists without names are replaced",
+			base:     tree{"Stages": list{"a", "b"}},
+			override: tree{"Stages": list{"c"}},
+			expected: tree{"Stages": list{"c"}},
+		},
+		{
+			name:     "partially named list is replaced",
+			base:     list{tree{"name": "a"}},
+			override: list{tree{"name": "b"}, tree{"type": "Shell"}},
+			expected: list{tree{"name": "b"}, tree{"type": "Shell"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if merged := merge(test.base, test.override); !reflect.DeepEqual(merged, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, merged)
+			}
+		})
+	}
+}
+
+func TestInterpolateString(t *testing.T) {
+	os.Setenv("QP_TEST_SET", "value")
+	os.Setenv("QP_TEST_EMPTY", "")
+	os.Setenv("QP_TEST_NUMBER", "8")
+	os.Unsetenv("QP_TEST_UNSET")
+	defer func() {
+		os.Unsetenv("QP_TEST_SET")
+		os.Unsetenv("QP_TEST_EMPTY")
+		os.Unsetenv("QP_TEST_NUMBER")
+	}()
+
+	tests := []struct {
+		value    string
+		expected interface{}
+		error    string
+	}{
+		{value: "plain", expected: "plain"},
+		{value: "${QP_TEST_SET}", expected: "value"},
+		{value: "prefix-${QP_TEST_SET}-suffix", expected: "prefix-value-suffix"},
+		{value: "${QP_TEST_UNSET:-fallback}", expected: "fallback"},
+		{value: "${QP_TEST_SET:-fallback}", expected: "value"},
+		{value: "${QP_TEST_EMPTY:-fallback}", expected: "fallback"},
+		{value: "${QP_TEST_EMPTY}", expected: ""},
+		{value: "${QP_TEST_UNSET:-}", expected: ""},
+		{value: "${QP_TEST_UNSET:-a b:c}", expected: "a b:c"},
+		{value: "${QP_TEST_NUMBER}", expected: 8},
+		{value: "${QP_TEST_UNSET:-1.5}", expected: 1.5},
+		{value: "${QP_TEST_UNSET:-true}", expected: true},
+		{value: "${QP_TEST_UNSET:-[1, 2]}", expected: "[1, 2]"},
+		{value: "x${QP_TEST_NUMBER}", expected: "x8"},
+		{value: "$${QP_TEST_SET}", expected: "${QP_TEST_SET}"},
+		{value: "$${QP_TEST_UNSET}", expected: "${QP_TEST_UNSET}"},
+		{value: "$${QP_TEST_NUMBER}", expected: "${QP_TEST_NUMBER}"},
+		{value: "$${QP_TEST_SET} ${QP_TEST_SET}", expected: "${QP_TEST_SET} value"},
+		{value: "$QP_TEST_SET", expected: "$QP_TEST_SET"},
+		{value: "${QP_TEST_UNSET}", error: "options.A: environment variable QP_TEST_UNSET is not set"},
+		{
+			value: "${QP_TEST_UNSET}${QP_TEST_SET}${QP_TEST_UNSET_TOO}",
+			error: "options.A: environment variable QP_TEST_UNSET, QP_TEST_UNSET_TOO is not set",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			result, err := interpolateString("options.A", test.value)
+			if test.error != "" {
+				if err == nil || err.Error() != test.error {
+					t.Fatalf("expected error %q, got %v", test.error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Fatalf("expected %#v, got %#v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestReadConfigTree(t *testing.T) {
+	os.Setenv("QP_TEST_THREADS", "16")
+	defer os.Unsetenv("QP_TEST_THREADS")
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected tree
+		error    string
+	}{
+		{
+			name: "included files are merged in order, including file on top",
+			files: map[string]string{
+				"base.yaml": "general:\n  log:\n    level: warn\nqueue:\n  - name: q\n    type: Dummy\n" +
+					"strategy:\n  - name: s\n    type: ParallelProcessing\n    options:\n      MaxThreads: 4\n      Queue: q\n",
+				"dev.json":    `{"general": {"log": {"level": "info"}}, "queue": [{"name": "q", "options": {"RandomSleepDelay": 1}}]}`,
+				"config.yaml": "include: [base.yaml, dev.json]\nstrategy:\n  - name: s\n    options:\n      MaxThreads: ${QP_TEST_THREADS:-4}\n",
+			},
+			expected: tree{
+				"general": tree{"log": tree{"level": "info"}},
+				"queue":   list{tree{"name": "q", "type": "Dummy", "options": tree{"RandomSleepDelay": 1}}},
+				"strategy": list{tree{"name": "s", "type": "ParallelProcessing", "options": tree{
+					"MaxThreads": 16,
+					"Queue":      "q",
+				}}},
+			},
+		},
+		{
+			name: "nested includes are relative to including file",
+			files: map[string]string{
+				"shared/base.toml": "[general.log]\nlevel = \"debug\"\n",
+				"shared/all.yaml":  "include: [base.toml]\n",
+				"config.yaml":      "include: [shared/all.yaml]\n",
+			},
+			expected: tree{"general": tree{"log": tree{"level": "debug"}}},
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"other.yaml":  "include: [config.yaml]\n",
+				"config.yaml": "include: [other.yaml]\n",
+			},
+			error: "includes itself",
+		},
+		{
+			name:  "include is not a list",
+			files: map[string]string{"config.yaml": "include: base.yaml\n"},
+			error: "include should be a list of files",
+		},
+		{
+			name:  "configuration is not a map",
+			files: map[string]string{"config.yaml": "- a\n- b\n"},
+			error: "configuration should be a map",
+		},
+		{
+			name:  "missing environment variable in included file",
+			files: map[string]string{"base.yaml": "general:\n  log:\n    level: ${QP_TEST_UNSET}\n", "config.yaml": "include: [base.yaml]\n"},
+			error: "general.log.level: environment variable QP_TEST_UNSET is not set",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "qp-config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, content := range test.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := readConfigTree(filepath.Join(dir, "config.yaml"), nil)
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Fatalf("expected error containing %q, got %v", test.error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package qp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Control socket commands
+const (
+	ControlCommandStatus = "status"
+)
+
+// controlTimeout - time given to control socket client and server to exchange command and response
+const controlTimeout = 5 * time.Second
+
+// controlResponse - response of control socket, one JSON line
+type controlResponse struct {
+	Status *Status `json:"status,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// startControlSocket listens for commands on general.controlSocket, nothing is served if it is not set.
+// Each connection carries one command line and gets one JSON line in response. Socket is removed on exit
+func startControlSocket(context *Context) error {
+	path := context.Configuration.General.ControlSocket
+	if path == "" {
+		return nil
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("Can't open control socket: %s", err.Error())
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("Can't open control socket: %s", err.Error())
+	}
+	context.OnTerminate(func() {
+		listener.Close()
+	})
+
+	logger.WithField("path", path).Info("Listening on control socket")
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				logger.WithField("error", err).Debug("Control socket closed")
+				return
+			}
+			go handleControl(context, conn)
+		}
+	}()
+	return nil
+}
+
+// removeStaleSocket removes socket left by qp which was not shut down properly.
+// Socket of running qp is not removed
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Can't open control socket: %s", err.Error())
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("Can't open control socket: %s exists and it is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, controlTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("Can't open control socket: %s is used by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// handleControl executes command of the connection
+func handleControl(context *Context, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	command, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		logger.WithField("error", err).Debug("Can't read control command")
+		return
+	}
+	command = strings.TrimSpace(command)
+	logger.WithField("command", command).Debug("Control command received")
+
+	var response controlResponse
+	switch command {
+	case ControlCommandStatus:
+		status := currentStatus(context)
+		response.Status = &status
+	default:
+		response.Error = fmt.Sprintf("unknown command %q", command)
+	}
+	if err := json.NewEncoder(conn).Encode(response); err != nil {
+		logger.WithField("error", err).Debug("Can't write control response")
+	}
+}
+
+// currentStatus returns status of the application, queue depth is requested within controlTimeout
+func currentStatus(c *Context) Status {
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+	return c.Status(ctx)
+}
+
+// QueryStatus requests status of qp running with the configuration through its control socket
+func QueryStatus(config *Config) (*Status, error) {
+	path := config.General.ControlSocket
+	if path == "" {
+		return nil, fmt.Errorf("Control socket is not configured (general.controlSocket)")
+	}
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if _, err := fmt.Fprintln(conn, ControlCommandStatus); err != nil {
+		return nil, err
+	}
+	var response controlResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("%s", response.Error)
+	}
+	if response.Status == nil {
+		return nil, fmt.Errorf("Empty response")
+	}
+	return response.Status, nil
+}
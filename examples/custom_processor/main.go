@@ -0,0 +1,55 @@
+// Example of qp embedded as a library with custom processor registered.
+//
+//	go run ./examples/custom_processor examples/custom_processor/config.yaml
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iVariable/qp"
+)
+
+// Uppercase - custom processor which prints message body in upper case.
+// Acknowledges messages with non-empty body, rejects empty ones
+type Uppercase struct {
+	prefix string
+}
+
+// Configure - configure processor
+func (u *Uppercase) Configure(configuration map[string]interface{}) error {
+	if prefix, ok := configuration["Prefix"].(string); ok {
+		u.prefix = prefix
+	}
+	return nil
+}
+
+// Process - process job
+func (u *Uppercase) Process(ctx context.Context, job qp.IJob) error {
+	body := fmt.Sprint(job.GetMessage().GetBody())
+	if body == "" {
+		return job.RejectMessage()
+	}
+	fmt.Println(u.prefix + strings.ToUpper(body))
+	return job.AckMessage()
+}
+
+func main() {
+	qp.RegisterProcessor("Uppercase", func() qp.IProcessor {
+		return &Uppercase{}
+	})
+
+	config, err := qp.LoadConfig(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code, err := qp.Run(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,112 @@
+package qp
+
+import (
+	"encoding/json"
+	"fmt"
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Health endpoints
+const (
+	HealthPathLive  = "/healthz"
+	HealthPathReady = "/readyz"
+)
+
+// healthTimeout - time given to dispatch loop to answer liveness check and to probe to get response
+const healthTimeout = 5 * time.Second
+
+// liveness - response of liveness endpoint
+type liveness struct {
+	Alive bool `json:"alive"`
+}
+
+// startHealthServer serves health endpoints on general.health.address, nothing is served if it is not set.
+// Liveness (/healthz) means dispatch loop is alive, readiness (/readyz) is described by Context.Readiness
+func startHealthServer(context *Context) error {
+	address := context.Configuration.General.Health.Address
+	if address == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("Can't serve health endpoints: %s", err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(HealthPathLive, func(w http.ResponseWriter, r *http.Request) {
+		alive := context.IsAlive(healthTimeout)
+		writeHealth(w, alive, liveness{Alive: alive})
+	})
+	mux.HandleFunc(HealthPathReady, func(w http.ResponseWriter, r *http.Request) {
+		readiness := context.Readiness()
+		writeHealth(w, readiness.Ready, readiness)
+	})
+
+	logger.WithField("address", listener.Addr().String()).Info("Serving health endpoints")
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.WithField("error", err).Error("Health endpoints stopped")
+		}
+	}()
+	return nil
+}
+
+// writeHealth writes JSON response, status is 503 if application is not healthy
+func writeHealth(w http.ResponseWriter, healthy bool, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// ProbeHealth requests readiness (or liveness if live is set) of qp running with the configuration.
+// Returns response body and whether application is healthy
+func ProbeHealth(config *Config, live bool) (string, bool, error) {
+	address := config.General.Health.Address
+	if address == "" {
+		return "", false, fmt.Errorf("Health endpoints are not configured (general.health.address)")
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", false, fmt.Errorf("Wrong health address %q: %s", address, err.Error())
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	path := HealthPathReady
+	if live {
+		path = HealthPathLive
+	}
+	client := http.Client{Timeout: healthTimeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + path)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return string(body), resp.StatusCode == http.StatusOK, nil
+}
+
+// healthConfigErrors returns problems of health endpoints configuration
+func healthConfigErrors(config core.HealthConfig) *utils.DecodeError {
+	errs := &utils.DecodeError{}
+	if config.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Address); err != nil {
+			errs.Add("general.health.address", "wrong address %q, host:port expected", config.Address)
+		}
+	}
+	if config.ConsumeTimeout < 0 {
+		errs.Add("general.health.consumeTimeout", "should be >= 0")
+	}
+	return errs
+}
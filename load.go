@@ -0,0 +1,459 @@
+package qp
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/resources"
+	"github.com/iVariable/qp/src/utils"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var logger = log.WithFields(log.Fields{
+	"build": "<buildID>",
+})
+
+// Load configures logger, queues, processors and strategy of the context
+func Load(context *Context) error {
+	if err := loadLogger(context); err != nil {
+		return err
+	}
+	if err := loadTracing(context); err != nil {
+		return err
+	}
+	context.OnTerminate(shutdownTracing)
+
+	logger.WithField("path", context.Configuration.Path).Info("Loading main configuration")
+
+	if err := loadComponents(context, nil); err != nil {
+		return err
+	}
+	if err := loadStrategies(context); err != nil {
+		return err
+	}
+
+	context.Set("IsRunning", false)
+
+	return nil
+}
+
+// loadComponents configures queues, middleware and processors of the context.
+// Components of previous context with unchanged configuration are reused (except linkable ones)
+func loadComponents(context *Context, previous *Context) error {
+	if err := loadQueues(context, previous); err != nil {
+		return err
+	}
+	if err := loadMiddleware(context, previous); err != nil {
+		return err
+	}
+	if err := loadProcessors(context, previous); err != nil {
+		return err
+	}
+	return linkProcessors(context)
+}
+
+func loadQueues(context *Context, previous *Context) error {
+	for i, config := range context.Configuration.Queue {
+		if previous != nil && unchanged(previous.Configuration.Queue, config) {
+			context.AvailableQueues[config.Name] = previous.AvailableQueues[config.Name]
+			continue
+		}
+		newQueue, ok := resources.AvailableQueues[config.Type]
+		if !ok {
+			logger.WithField("requestedType", config.Type).Error("Unknown queue type requested")
+			return fmt.Errorf("Unknown queue type requested: %s", config.Type)
+		}
+		newInstance := newQueue()
+		if err := newInstance.Configure(config.Options); err != nil {
+			err = atPath(fmt.Sprintf("queue[%d].options", i), err)
+			logger.WithField("error", err).Error("Error configuring queue")
+			return fmt.Errorf("Error configuring queue %s: %s", config.Name, err.Error())
+		}
+		if len(config.Codecs) > 0 {
+			var codecs []core.ICodec
+			for j, codecConfig := range config.Codecs {
+				newCodec, ok := resources.AvailableCodecs[codecConfig.Type]
+				if !ok {
+					logger.WithField("requestedType", codecConfig.Type).Error("Unknown codec type requested")
+					return fmt.Errorf("Unknown codec type requested: %s", codecConfig.Type)
+				}
+				codec := newCodec()
+				if err := codec.Configure(codecConfig.Options); err != nil {
+					err = atPath(fmt.Sprintf("queue[%d].codecs[%d].options", i, j), err)
+					logger.WithField("error", err).Error("Error configuring codec")
+					return fmt.Errorf("Error configuring codec %s: %s", codecConfig.Type, err.Error())
+				}
+				codecs = append(codecs, codec)
+			}
+			newInstance = core.NewCodecQueue(newInstance, codecs)
+		}
+		context.AvailableQueues[config.Name] = &newInstance
+	}
+	return nil
+}
+
+func loadProcessors(context *Context, previous *Context) error {
+	for i, config := range context.Configuration.Processor {
+		if previous != nil && unchanged(previous.Configuration.Processor, config) {
+			if processor := previous.AvailableProcessors[config.Name]; !isLinkable(*processor) {
+				context.AvailableProcessors[config.Name] = processor
+				continue
+			}
+		}
+		newValue, ok := resources.AvailableProcessors[config.Type]
+		if !ok {
+			logger.WithField("requestedType", config.Type).Error("Unknown processor type requested")
+			return fmt.Errorf("Unknown processor type requested: %s", config.Type)
+		}
+		newInstance := newValue()
+		if err := newInstance.Configure(config.Options); err != nil {
+			err = atPath(fmt.Sprintf("processor[%d].options", i), err)
+			logger.WithField("error", err).Error("Error configuring processor")
+			return fmt.Errorf("Error configuring processor %s: %s", config.Name, err.Error())
+		}
+		context.AvailableProcessors[config.Name] = &newInstance
+	}
+	return nil
+}
+
+func loadMiddleware(context *Context, previous *Context) error {
+	for i, config := range context.Configuration.Middleware {
+		if previous != nil && unchanged(previous.Configuration.Middleware, config) {
+			if middleware := previous.AvailableMiddleware[config.Name]; !isLinkable(*middleware) {
+				context.AvailableMiddleware[config.Name] = middleware
+				continue
+			}
+		}
+		newValue, ok := resources.AvailableMiddleware[config.Type]
+		if !ok {
+			logger.WithField("requestedType", config.Type).Error("Unknown middleware type requested")
+			return fmt.Errorf("Unknown middleware type requested: %s", config.Type)
+		}
+		newInstance := newValue()
+		if err := newInstance.Configure(config.Options); err != nil {
+			err = atPath(fmt.Sprintf("middleware[%d].options", i), err)
+			logger.WithField("error", err).Error("Error configuring middleware")
+			return fmt.Errorf("Error configuring middleware %s: %s", config.Name, err.Error())
+		}
+		context.AvailableMiddleware[config.Name] = &newInstance
+	}
+	return nil
+}
+
+// linkProcessors lets composed processors and middleware resolve components they use.
+// Processors referencing each other in a cycle are not linked
+func linkProcessors(context *Context) error {
+	if cycle := processorCycle(&context.Configuration); cycle != nil {
+		logger.WithField("cycle", cycle).Error("Processors reference each other in a cycle")
+		return fmt.Errorf("Processors reference each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+	for name, middleware := range context.AvailableMiddleware {
+		if err := link(name, *middleware, context); err != nil {
+			return err
+		}
+	}
+	for name, processor := range context.AvailableProcessors {
+		if err := link(name, *processor, context); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLinkable returns true for components which depend on other components. They are never reused on reload
+func isLinkable(component interface{}) bool {
+	_, ok := component.(core.ILinkable)
+	return ok
+}
+
+func link(name string, component interface{}, context *Context) error {
+	linkable, ok := component.(core.ILinkable)
+	if !ok {
+		return nil
+	}
+	if err := linkable.Link(context); err != nil {
+		logger.WithFields(log.Fields{
+			"component": name,
+			"error":     err,
+		}).Error("Error linking component")
+		return fmt.Errorf("Error linking %s: %s", name, err.Error())
+	}
+	return nil
+}
+
+func loadStrategies(context *Context) error {
+	if len(context.Configuration.Strategy) != 1 {
+		logger.Error("There should be exactly one Strategy configured")
+		return errors.New("There should be exactly one Strategy configured")
+	}
+	for i, config := range context.Configuration.Strategy {
+		newValue, ok := resources.AvailableStrategies[config.Type]
+		if !ok {
+			logger.WithField("requestedType", config.Type).Error("Unknown strategy type requested")
+			return fmt.Errorf("Unknown strategy type requested: %s", config.Type)
+		}
+		options := make(map[string]interface{})
+		for k, v := range config.Options {
+			options[k] = v
+		}
+		options["Name"] = config.Name
+
+		newInstance := newValue()
+		if err := configureStrategy(newInstance, options, context); err != nil {
+			closeComponent(config.Name, newInstance)
+			err = atPath(fmt.Sprintf("strategy[%d].options", i), err)
+			logger.WithField("error", err).Error("Error configuring strategy")
+			return fmt.Errorf("Error configuring strategy %s: %s", config.Name, err.Error())
+		}
+		context.AvailableStrategies[config.Name] = &newInstance
+	}
+
+	context.Strategy = *context.AvailableStrategies[context.Configuration.Strategy[0].Name]
+	return nil
+}
+
+// atPath adds YAML path of misconfigured options to the error
+func atPath(path string, err error) error {
+	errs := &utils.DecodeError{}
+	errs.Merge(path, err)
+	return errs
+}
+
+// configureStrategy configures strategy, panics of misconfigured strategy are returned as errors
+func configureStrategy(strategy core.IProcessingStrategy, options map[string]interface{}, context *Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return strategy.Configure(options, context)
+}
+
+// status prints status table to stdout (on SIGUSR1), see also qp status command
+func status(context *Context) {
+	current := currentStatus(context)
+	RenderStatus(os.Stdout, &current, nil)
+}
+
+// stop stops the strategy, application is terminated if strategy can't be stopped
+func stop(context *Context) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	if err := stopStrategy(context); err != nil {
+		logger.WithField("error", err).Error("Error stopping strategy")
+		context.SendTerminate(utils.ExitCodeRuntimeError)
+	}
+}
+
+// stopStrategy stops the strategy waiting for in-flight jobs
+func stopStrategy(context *Context) error {
+	context.Set("StrategyInitiatedStop", false)
+	if err := context.CurrentStrategy().Stop(); err != nil {
+		return err
+	}
+	context.Set("IsRunning", false)
+	return nil
+}
+
+func run(context *Context) {
+	context.Set("StrategyInitiatedStop", true)
+
+	logger.Info("Start processing queue")
+	context.Set("IsRunning", true)
+	strategy := context.CurrentStrategy()
+	if err := strategy.Start(context.ProcessingContext()); err == nil {
+		if context.GetOrNil("StrategyInitiatedStop").(bool) && context.CurrentStrategy() == strategy {
+			context.SendTerminate(0)
+		}
+	} else {
+		logger.WithField("error", err).Error("Error running strategy")
+		context.SendTerminate(utils.ExitCodeRuntimeError)
+	}
+}
+
+// reloadMutex - only one reload is performed at a time
+var reloadMutex sync.Mutex
+
+// reload reads configuration file again and restarts components whose configuration changed.
+// Strategy is stopped (in-flight jobs are drained) before components are replaced.
+// If new configuration is invalid the running one is kept
+func reload(context *Context) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	running := context.Configuration
+	if running.Path == "" {
+		logger.Error("Configuration was not loaded from file. Reload skipped")
+		return
+	}
+	if isRunning, _ := context.GetOrNil("StrategyInitiatedStop").(bool); !isRunning {
+		logger.Warn("Processing is not running. Reload skipped")
+		return
+	}
+
+	logger.WithField("path", running.Path).Info("Reloading configuration")
+	config, err := LoadConfig(running.Path, running.Overrides...)
+	if err != nil {
+		logger.WithField("error", err).Error("Can't load config file. Running configuration kept")
+		return
+	}
+
+	staged := core.NewContext(config)
+	changes := configChanges(&running, &staged.Configuration)
+	if len(changes) == 0 {
+		logger.Info("Configuration not changed")
+		return
+	}
+	logger.WithField("changes", changes).Info("Configuration changed")
+
+	if err := logConfigErrors(staged.Configuration.General.Log).OrNil(); err != nil {
+		logger.WithField("error", err).Error("Invalid configuration. Running configuration kept")
+		return
+	}
+	if err := tracingConfigErrors(staged.Configuration.General.Tracing).OrNil(); err != nil {
+		logger.WithField("error", err).Error("Invalid configuration. Running configuration kept")
+		return
+	}
+	tracingChanged := running.General.Tracing != staged.Configuration.General.Tracing
+	if running.General.Health.Address != staged.Configuration.General.Health.Address {
+		logger.WithField("address", running.General.Health.Address).Warn("Health address can't be changed without restart. Running address kept")
+		staged.Configuration.General.Health.Address = running.General.Health.Address
+	}
+	if running.General.ControlSocket != staged.Configuration.General.ControlSocket {
+		logger.WithField("path", running.General.ControlSocket).Warn("Control socket can't be changed without restart. Running socket kept")
+		staged.Configuration.General.ControlSocket = running.General.ControlSocket
+	}
+
+	if !componentsChanged(changes) {
+		context.ReplaceGeneral(&staged.Configuration)
+		reloadLogger(context)
+		if tracingChanged {
+			reloadTracing(context)
+		}
+		logger.Info("Configuration reloaded")
+		return
+	}
+
+	if err := loadComponents(staged, context); err != nil {
+		logger.WithField("error", err).Error("Invalid configuration. Running configuration kept")
+		closeComponents(staged, context)
+		return
+	}
+
+	if err := loadStrategies(staged); err != nil {
+		logger.WithField("error", err).Error("Invalid configuration. Running configuration kept")
+		closeComponents(staged, context)
+		return
+	}
+
+	logger.Info("Stopping processing to apply configuration")
+	if err := stopStrategy(context); err != nil {
+		logger.WithField("error", err).Error("Error stopping strategy. Running configuration kept")
+		closeComponent("strategy", staged.Strategy)
+		closeComponents(staged, context)
+		return
+	}
+	closeComponent("strategy", context.Strategy)
+	closeComponents(context, staged)
+	context.Replace(staged)
+	reloadLogger(context)
+	if tracingChanged {
+		reloadTracing(context)
+	}
+
+	logger.Info("Configuration reloaded")
+	context.SendRun()
+}
+
+// configChanges returns list of changed sections and components, e.g. "processor Image resizer"
+func configChanges(running *Config, config *Config) []string {
+	var changes []string
+	if !reflect.DeepEqual(running.General, config.General) {
+		changes = append(changes, "general")
+	}
+	changes = append(changes, changedEntries("queue", running.Queue, config.Queue)...)
+	changes = append(changes, changedEntries("middleware", running.Middleware, config.Middleware)...)
+	changes = append(changes, changedEntries("processor", running.Processor, config.Processor)...)
+	changes = append(changes, changedEntries("strategy", running.Strategy, config.Strategy)...)
+	return changes
+}
+
+func componentsChanged(changes []string) bool {
+	return len(changes) > 1 || changes[0] != "general"
+}
+
+// changedEntries returns added, changed and removed entries of configuration section
+func changedEntries(kind string, running interface{}, entries interface{}) []string {
+	var changes []string
+	list := reflect.ValueOf(entries)
+	for i := 0; i < list.Len(); i++ {
+		if !unchanged(running, list.Index(i).Interface()) {
+			changes = append(changes, kind+" "+list.Index(i).FieldByName("Name").String())
+		}
+	}
+	list = reflect.ValueOf(running)
+	for i := 0; i < list.Len(); i++ {
+		if !containsEntry(entries, list.Index(i).FieldByName("Name").String()) {
+			changes = append(changes, kind+" "+list.Index(i).FieldByName("Name").String()+" (removed)")
+		}
+	}
+	return changes
+}
+
+// unchanged returns true if entries (configuration section) hold entry with the same name and configuration
+func unchanged(entries interface{}, entry interface{}) bool {
+	name := reflect.ValueOf(entry).FieldByName("Name").String()
+	list := reflect.ValueOf(entries)
+	for i := 0; i < list.Len(); i++ {
+		if list.Index(i).FieldByName("Name").String() == name {
+			return reflect.DeepEqual(list.Index(i).Interface(), entry)
+		}
+	}
+	return false
+}
+
+func containsEntry(entries interface{}, name string) bool {
+	list := reflect.ValueOf(entries)
+	for i := 0; i < list.Len(); i++ {
+		if list.Index(i).FieldByName("Name").String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// closeComponents closes components of the context which are not used by kept context
+func closeComponents(context *Context, kept *Context) {
+	for name, queue := range context.AvailableQueues {
+		if kept.AvailableQueues[name] != queue {
+			closeComponent(name, *queue)
+		}
+	}
+	for name, middleware := range context.AvailableMiddleware {
+		if kept.AvailableMiddleware[name] != middleware {
+			closeComponent(name, *middleware)
+		}
+	}
+	for name, processor := range context.AvailableProcessors {
+		if kept.AvailableProcessors[name] != processor {
+			closeComponent(name, *processor)
+		}
+	}
+}
+
+func closeComponent(name string, component interface{}) {
+	closable, ok := component.(core.IClosable)
+	if !ok {
+		return
+	}
+	if err := closable.Close(); err != nil {
+		logger.WithFields(log.Fields{
+			"component": name,
+			"error":     err,
+		}).Error("Error closing component")
+	}
+}
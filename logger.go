@@ -0,0 +1,117 @@
+package qp
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	logrus_syslog "github.com/Sirupsen/logrus/hooks/syslog"
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"io/ioutil"
+	"log/syslog"
+	"os"
+)
+
+// Log formats and outputs
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	LogOutputStderr = "stderr"
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+)
+
+// logFile - log file opened by loadLogger, it is closed when logger is configured again
+var logFile io.Closer
+
+// loadLogger configures level, format and output of the logger
+func loadLogger(context *Context) error {
+	config := context.Configuration.General.Log
+	if err := logConfigErrors(config).OrNil(); err != nil {
+		return fmt.Errorf("Wrong log configuration: %s", err.Error())
+	}
+	level, _ := log.ParseLevel(config.Level)
+
+	var formatter log.Formatter = &log.TextFormatter{}
+	if config.Format == LogFormatJSON {
+		formatter = &log.JSONFormatter{}
+	}
+
+	hooks := make(log.LevelHooks)
+	var output io.Writer
+	var file io.Closer
+	switch config.Output {
+	case LogOutputStderr:
+		output = os.Stderr
+	case LogOutputStdout:
+		output = os.Stdout
+	case LogOutputFile:
+		rotated := &lumberjack.Logger{
+			Filename:   config.File,
+			MaxSize:    config.MaxSize,
+			MaxBackups: config.MaxBackups,
+			MaxAge:     config.MaxAge,
+			Compress:   config.Compress,
+		}
+		output, file = rotated, rotated
+	case LogOutputSyslog:
+		network := ""
+		if config.Syslog != "" {
+			network = "udp"
+		}
+		hook, err := logrus_syslog.NewSyslogHook(network, config.Syslog, syslog.LOG_INFO, "qp")
+		if err != nil {
+			return fmt.Errorf("Can't connect to syslog: %s", err.Error())
+		}
+		hooks.Add(hook)
+		output = ioutil.Discard
+	}
+
+	log.SetLevel(level)
+	log.SetFormatter(formatter)
+	log.SetOutput(output)
+	log.StandardLogger().Hooks = hooks
+
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	return nil
+}
+
+// reloadLogger applies changed log configuration, errors are logged and the running logger is kept
+func reloadLogger(context *Context) {
+	if err := loadLogger(context); err != nil {
+		logger.WithField("error", err).Error("Can't configure logger")
+	}
+}
+
+// logConfigErrors returns problems of log configuration. Empty values stand for defaults
+func logConfigErrors(config core.LogConfig) *utils.DecodeError {
+	errs := &utils.DecodeError{}
+	if _, err := log.ParseLevel(config.Level); err != nil && config.Level != "" {
+		errs.Add("general.log.level", "unknown log level %q", config.Level)
+	}
+	switch config.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		errs.Add("general.log.format", "unknown log format %q, %s or %s expected", config.Format, LogFormatText, LogFormatJSON)
+	}
+	switch config.Output {
+	case "", LogOutputStderr, LogOutputStdout, LogOutputSyslog:
+	case LogOutputFile:
+		if config.File == "" {
+			errs.Add("general.log.file", "log file should be set for file output")
+		}
+	default:
+		errs.Add("general.log.output", "unknown log output %q, one of %s, %s, %s, %s expected",
+			config.Output, LogOutputStderr, LogOutputStdout, LogOutputFile, LogOutputSyslog)
+	}
+	if config.MaxSize < 0 || config.MaxBackups < 0 || config.MaxAge < 0 {
+		errs.Add("general.log", "maxSize, maxBackups and maxAge should be >= 0")
+	}
+	return errs
+}
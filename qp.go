@@ -0,0 +1,138 @@
+// Package qp - queue processor.
+//
+// Besides standalone usage qp can be embedded into your application as a library:
+// register your own queues, processors and strategies and call Run with the configuration
+//
+//	qp.RegisterProcessor("MyProcessor", func() qp.IProcessor {
+//		return &MyProcessor{}
+//	})
+//	config, err := qp.LoadConfig("config.yaml")
+//	...
+//	code, err := qp.Run(config)
+//	...
+//	os.Exit(code)
+package qp
+
+import (
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/resources"
+	"github.com/iVariable/qp/src/utils"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// Config - application configuration
+	Config = core.Config
+
+	// Context - application context
+	Context = core.Context
+
+	// IConsumableQueue - consumable queue interface
+	IConsumableQueue = core.IConsumableQueue
+
+	// IProcessingStrategy - processing strategy interface
+	IProcessingStrategy = core.IProcessingStrategy
+
+	// IProcessor - job processor interface
+	IProcessor = core.IProcessor
+
+	// IMiddleware - processing middleware interface
+	IMiddleware = core.IMiddleware
+
+	// ICodec - message body codec interface
+	ICodec = core.ICodec
+
+	// ProcessFunc - job processing function
+	ProcessFunc = core.ProcessFunc
+
+	// IJob - job interface
+	IJob = core.IJob
+
+	// IMessage - message interface
+	IMessage = core.IMessage
+
+	// Message - simple message struct
+	Message = core.Message
+
+	// Status - state of running application returned by control socket
+	Status = core.Status
+)
+
+// RegisterQueue makes queue type available for configuration
+func RegisterQueue(typeName string, factory func() IConsumableQueue) {
+	resources.RegisterQueue(typeName, factory)
+}
+
+// RegisterStrategy makes processing strategy type available for configuration
+func RegisterStrategy(typeName string, factory func() IProcessingStrategy) {
+	resources.RegisterStrategy(typeName, factory)
+}
+
+// RegisterProcessor makes processor type available for configuration
+func RegisterProcessor(typeName string, factory func() IProcessor) {
+	resources.RegisterProcessor(typeName, factory)
+}
+
+// RegisterMiddleware makes middleware type available for configuration
+func RegisterMiddleware(typeName string, factory func() IMiddleware) {
+	resources.RegisterMiddleware(typeName, factory)
+}
+
+// RegisterCodec makes message body codec type available for configuration
+func RegisterCodec(typeName string, factory func() ICodec) {
+	resources.RegisterCodec(typeName, factory)
+}
+
+// LoadConfig reads configuration file (YAML, or JSON and TOML detected by .json and .toml extension), merges files it includes, interpolates environment variables
+// and applies overrides to it. Unknown configuration keys are errors, component options are checked
+// when components are configured (see Validate).
+// Overrides are remembered and applied again when configuration is reloaded
+func LoadConfig(path string, overrides ...func(config *Config) error) (*Config, error) {
+	tree, err := readConfigTree(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	source, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(source, &config); err != nil {
+		return nil, err
+	}
+
+	config.Path = path
+	config.Overrides = overrides
+	for _, override := range overrides {
+		if err := override(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &config, nil
+}
+
+// Run configures queues, processors and strategy and runs the application dispatch loop.
+// Returns error if configuration fails, otherwise blocks until the application terminates and returns
+// its exit code (see utils.ExitCode* constants). Run never exits the process itself.
+// Configuration loaded by LoadConfig is reloaded on SIGHUP
+func Run(config *Config) (int, error) {
+	context := core.NewContext(config)
+
+	if err := Load(context); err != nil {
+		return utils.ExitCodeMisconfiguration, err
+	}
+	if err := startHealthServer(context); err != nil {
+		return utils.ExitCodeMisconfiguration, err
+	}
+	if err := startControlSocket(context); err != nil {
+		return utils.ExitCodeMisconfiguration, err
+	}
+
+	go func() {
+		context.SendRun()
+	}()
+
+	return context.DispatchLoop(run, stop, status, reload), nil
+}
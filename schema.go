@@ -0,0 +1,260 @@
+package qp
+
+import (
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/resources"
+	"github.com/iVariable/qp/src/utils"
+	"sort"
+)
+
+// variableSchema - string value interpolated from environment variable, allowed in place of numbers and booleans
+var variableSchema = map[string]interface{}{
+	"type":    "string",
+	"pattern": `^\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}$`,
+}
+
+// Schema returns JSON Schema of configuration file. Options of every registered queue, codec, middleware,
+// processor and strategy type are described by their options structs (see IOptionsProvider)
+func Schema() map[string]interface{} {
+	queueTypes := make(map[string]interface{})
+	for name, newQueue := range resources.AvailableQueues {
+		queueTypes[name] = newQueue()
+	}
+	codecTypes := make(map[string]interface{})
+	for name, newCodec := range resources.AvailableCodecs {
+		codecTypes[name] = newCodec()
+	}
+	middlewareTypes := make(map[string]interface{})
+	for name, newMiddleware := range resources.AvailableMiddleware {
+		middlewareTypes[name] = newMiddleware()
+	}
+	processorTypes := make(map[string]interface{})
+	for name, newProcessor := range resources.AvailableProcessors {
+		processorTypes[name] = newProcessor()
+	}
+	strategyTypes := make(map[string]interface{})
+	for name, newStrategy := range resources.AvailableStrategies {
+		strategyTypes[name] = newStrategy()
+	}
+
+	queue := componentSchema("queue", queueTypes)
+	queue["properties"].(map[string]interface{})["codecs"] = map[string]interface{}{
+		"type":  "array",
+		"items": componentSchema("codec", codecTypes),
+	}
+
+	return map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "qp configuration",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"include": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Files merged before this one",
+			},
+			"general": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"log": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": false,
+						"properties": map[string]interface{}{
+							"level": map[string]interface{}{
+								"enum":    []string{"panic", "fatal", "error", "warn", "warning", "info", "debug"},
+								"default": "warn",
+							},
+							"format": map[string]interface{}{
+								"enum":    []string{LogFormatText, LogFormatJSON},
+								"default": LogFormatText,
+							},
+							"output": map[string]interface{}{
+								"enum":    []string{LogOutputStderr, LogOutputStdout, LogOutputFile, LogOutputSyslog},
+								"default": LogOutputStderr,
+							},
+							"file": map[string]interface{}{
+								"type":        "string",
+								"description": "Log file for file output",
+							},
+							"maxSize": allowVariables(map[string]interface{}{
+								"type":        "integer",
+								"minimum":     0,
+								"description": "Size in megabytes log file is rotated at, 100 if not set",
+							}),
+							"maxBackups": allowVariables(map[string]interface{}{
+								"type":        "integer",
+								"minimum":     0,
+								"description": "Number of rotated files kept, all if not set",
+							}),
+							"maxAge": allowVariables(map[string]interface{}{
+								"type":        "integer",
+								"minimum":     0,
+								"description": "Days rotated files are kept, forever if not set",
+							}),
+							"compress": allowVariables(map[string]interface{}{
+								"type":        "boolean",
+								"description": "Compress rotated files with gzip",
+							}),
+							"syslog": map[string]interface{}{
+								"type":        "string",
+								"description": "Address (host:port) of syslog server for syslog output, local syslog if not set",
+							},
+						},
+					},
+					"tracing": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": false,
+						"properties": map[string]interface{}{
+							"exporter": map[string]interface{}{
+								"enum":        []string{"", TracingExporterOTLP, TracingExporterFile},
+								"description": "Spans exporter, tracing is disabled if not set",
+							},
+							"endpoint": map[string]interface{}{
+								"type":        "string",
+								"description": "Address (host:port) of OTLP gRPC collector",
+								"default":     defaultTracingEndpoint,
+							},
+							"insecure": allowVariables(map[string]interface{}{
+								"type":        "boolean",
+								"description": "Connect to OTLP collector without TLS",
+							}),
+							"file": map[string]interface{}{
+								"type":        "string",
+								"description": "Spans file for file exporter",
+							},
+							"serviceName": map[string]interface{}{
+								"type":    "string",
+								"default": defaultTracingServiceName,
+							},
+							"sampleRatio": allowVariables(map[string]interface{}{
+								"type":        "number",
+								"minimum":     0,
+								"maximum":     1,
+								"description": "Ratio of traces started by qp which are sampled, 1 if not set. Parent sampling decision is respected",
+							}),
+						},
+					},
+					"health": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": false,
+						"properties": map[string]interface{}{
+							"address": map[string]interface{}{
+								"type":        "string",
+								"description": "Address (host:port) health endpoints /healthz and /readyz are served on, disabled if not set",
+							},
+							"consumeTimeout": allowVariables(map[string]interface{}{
+								"type":        "integer",
+								"minimum":     0,
+								"default":     60,
+								"description": "Seconds consume may keep failing (or queue request may exceed its long polling wait) before application is not ready",
+							}),
+						},
+					},
+					"controlSocket": map[string]interface{}{
+						"type":        "string",
+						"description": "Unix socket qp status command queries, disabled if not set",
+					},
+					"shutdownTimeout": allowVariables(map[string]interface{}{
+						"type":    "integer",
+						"minimum": 0,
+						"default": 30,
+					}),
+				},
+			},
+			"queue":      sectionSchema(queue),
+			"middleware": sectionSchema(componentSchema("middleware", middlewareTypes)),
+			"processor":  sectionSchema(componentSchema("processor", processorTypes)),
+			"strategy": map[string]interface{}{
+				"type":     "array",
+				"items":    componentSchema("strategy", strategyTypes),
+				"minItems": 1,
+				"maxItems": 1,
+			},
+		},
+	}
+}
+
+func sectionSchema(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "array",
+		"items": items,
+	}
+}
+
+// componentSchema returns schema of configuration entry (name, type, options) of one of the component types.
+// Options are described by options struct of the selected type
+func componentSchema(kind string, types map[string]interface{}) map[string]interface{} {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var conditions []interface{}
+	for _, name := range names {
+		provider, ok := types[name].(core.IOptionsProvider)
+		if !ok {
+			continue
+		}
+		options := allowVariables(utils.Schema(provider.Options()))
+		if properties, ok := options["properties"].(map[string]interface{}); ok && kind == "strategy" {
+			// Name option of strategy is taken from the entry, see loadStrategies
+			delete(properties, "Name")
+		}
+		conditions = append(conditions, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"type": map[string]interface{}{"const": name}},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{"options": options},
+			},
+		})
+	}
+
+	properties := map[string]interface{}{
+		"type":    map[string]interface{}{"enum": names},
+		"options": map[string]interface{}{"type": "object"},
+	}
+	required := []string{"type"}
+	// codecs are not named
+	if kind != "codec" {
+		properties["name"] = map[string]interface{}{"type": "string", "minLength": 1}
+		required = append(required, "name")
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+		"required":             required,
+	}
+	if len(conditions) > 0 {
+		schema["allOf"] = conditions
+	}
+	return schema
+}
+
+// allowVariables lets numbers and booleans of the schema be written as environment variables, e.g. ${THREADS:-4}
+func allowVariables(schema map[string]interface{}) map[string]interface{} {
+	switch schema["type"] {
+	case "integer", "number", "boolean":
+		wrapper := map[string]interface{}{"anyOf": []interface{}{schema, variableSchema}}
+		if defaultValue, ok := schema["default"]; ok {
+			wrapper["default"] = defaultValue
+			delete(schema, "default")
+		}
+		return wrapper
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for name, property := range properties {
+			properties[name] = allowVariables(property.(map[string]interface{}))
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if nested, ok := schema[key].(map[string]interface{}); ok {
+			schema[key] = allowVariables(nested)
+		}
+	}
+	return schema
+}
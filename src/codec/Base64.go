@@ -0,0 +1,32 @@
+package codec
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Base64 - standard base64 encoding
+type Base64 struct{}
+
+// Configure - configure codec
+func (c *Base64) Configure(configuration map[string]interface{}) error {
+	return nil
+}
+
+// Decode - decode body
+func (c *Base64) Decode(body interface{}) (interface{}, error) {
+	encoded, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+}
+
+// Encode - encode body
+func (c *Base64) Encode(body interface{}) (interface{}, error) {
+	decoded, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString(decoded), nil
+}
@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// Gzip - gzip compression
+type Gzip struct{}
+
+// Configure - configure codec
+func (c *Gzip) Configure(configuration map[string]interface{}) error {
+	return nil
+}
+
+// Decode - decode body
+func (c *Gzip) Decode(body interface{}) (interface{}, error) {
+	compressed, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// Encode - encode body
+func (c *Gzip) Encode(body interface{}) (interface{}, error) {
+	decompressed, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(decompressed); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
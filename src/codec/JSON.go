@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"encoding/json"
+)
+
+// JSON - parses JSON body into generic structure (maps, slices, etc)
+type JSON struct{}
+
+// Configure - configure codec
+func (c *JSON) Configure(configuration map[string]interface{}) error {
+	return nil
+}
+
+// Decode - decode body
+func (c *JSON) Decode(body interface{}) (interface{}, error) {
+	encoded, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// Encode - encode body
+func (c *JSON) Encode(body interface{}) (interface{}, error) {
+	return json.Marshal(body)
+}
@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Msgpack - parses MessagePack body into generic structure (maps, slices, etc)
+type Msgpack struct{}
+
+// Configure - configure codec
+func (c *Msgpack) Configure(configuration map[string]interface{}) error {
+	return nil
+}
+
+// Decode - decode body
+func (c *Msgpack) Decode(body interface{}) (interface{}, error) {
+	encoded, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := msgpack.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// Encode - encode body
+func (c *Msgpack) Encode(body interface{}) (interface{}, error) {
+	return msgpack.Marshal(body)
+}
@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iVariable/qp/src/utils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io/ioutil"
+)
+
+// Protobuf - parses protobuf body into generic structure (same as JSON mapping of the message).
+// Message descriptor is taken from DescriptorSet file (protoc --include_imports --descriptor_set_out=...)
+type Protobuf struct {
+	configuration protobufConfiguration
+	descriptor    protoreflect.MessageDescriptor
+}
+
+type protobufConfiguration struct {
+	DescriptorSet string `required:"true"`
+	MessageType   string `required:"true"`
+}
+
+// Options returns options struct of the codec
+func (c *Protobuf) Options() interface{} {
+	return &protobufConfiguration{}
+}
+
+// Configure - configure codec
+func (c *Protobuf) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &c.configuration); err != nil {
+		return err
+	}
+	if c.configuration.DescriptorSet == "" || c.configuration.MessageType == "" {
+		return errors.New("DescriptorSet and MessageType settings for Protobuf codec should not be empty")
+	}
+
+	source, err := ioutil.ReadFile(c.configuration.DescriptorSet)
+	if err != nil {
+		return err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(source, &set); err != nil {
+		return fmt.Errorf("Can't parse descriptor set: %s", err.Error())
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return fmt.Errorf("Can't parse descriptor set: %s", err.Error())
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(c.configuration.MessageType))
+	if err != nil {
+		return fmt.Errorf("Can't find message type %s: %s", c.configuration.MessageType, err.Error())
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return fmt.Errorf("%s is not a message type", c.configuration.MessageType)
+	}
+	c.descriptor = messageDescriptor
+
+	return nil
+}
+
+// Decode - decode body
+func (c *Protobuf) Decode(body interface{}) (interface{}, error) {
+	encoded, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(c.descriptor)
+	if err := proto.Unmarshal(encoded, message); err != nil {
+		return nil, err
+	}
+	jsonBytes, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(jsonBytes, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// Encode - encode body
+func (c *Protobuf) Encode(body interface{}) (interface{}, error) {
+	jsonBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(c.descriptor)
+	if err := protojson.Unmarshal(jsonBytes, message); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(message)
+}
@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstd - zstandard compression
+type Zstd struct {
+	decoder *zstd.Decoder
+	encoder *zstd.Encoder
+}
+
+// Configure - configure codec
+func (c *Zstd) Configure(configuration map[string]interface{}) error {
+	var err error
+	if c.decoder, err = zstd.NewReader(nil); err != nil {
+		return err
+	}
+	c.encoder, err = zstd.NewWriter(nil)
+	return err
+}
+
+// Decode - decode body
+func (c *Zstd) Decode(body interface{}) (interface{}, error) {
+	compressed, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.decoder.DecodeAll(compressed, nil)
+}
+
+// Encode - encode body
+func (c *Zstd) Encode(body interface{}) (interface{}, error) {
+	decompressed, err := toBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.encoder.EncodeAll(decompressed, nil), nil
+}
@@ -0,0 +1,14 @@
+package codec
+
+import "fmt"
+
+// toBytes returns binary representation of encoded body
+func toBytes(body interface{}) ([]byte, error) {
+	switch value := body.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("Expected encoded body, got %T", body)
+}
@@ -0,0 +1,131 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var boltBucket = []byte("keys")
+
+// boltStores - open stores by database path. Database file is locked by the process, so strategies using the same
+// file (e.g. running and reloaded one) share the store
+var (
+	boltStores      = make(map[string]*BoltStore)
+	boltStoresMutex sync.Mutex
+)
+
+// BoltStore - on-disk store of keys (bbolt database), survives restarts.
+// Expired keys are removed periodically
+type BoltStore struct {
+	db   *bbolt.DB
+	stop chan bool
+	path string
+	refs int
+}
+
+// NewBoltStore - opens (creates) database file. Store of already open file is shared, it is closed
+// when all users close it
+func NewBoltStore(path string, cleanupInterval time.Duration) (*BoltStore, error) {
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	boltStoresMutex.Lock()
+	defer boltStoresMutex.Unlock()
+	if store, ok := boltStores[path]; ok {
+		store.refs++
+		return store, nil
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store := &BoltStore{
+		db:   db,
+		stop: make(chan bool),
+		path: path,
+		refs: 1,
+	}
+	boltStores[path] = store
+	go store.cleanup(cleanupInterval)
+	return store, nil
+}
+
+// Seen returns true if key was remembered and is not expired yet
+func (s *BoltStore) Seen(key string) (bool, error) {
+	seen := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(boltBucket).Get([]byte(key))
+		seen = value != nil && !expired(value, time.Now())
+		return nil
+	})
+	return seen, err
+}
+
+// Remember stores key for ttl
+func (s *BoltStore) Remember(key string, ttl time.Duration) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(time.Now().Add(ttl).UnixNano()))
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), value)
+	})
+}
+
+// Close stops cleanup and closes database once all users of the store closed it
+func (s *BoltStore) Close() error {
+	boltStoresMutex.Lock()
+	defer boltStoresMutex.Unlock()
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	delete(boltStores, s.path)
+	close(s.stop)
+	return s.db.Close()
+}
+
+func (s *BoltStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			s.db.Update(func(tx *bbolt.Tx) error {
+				bucket := tx.Bucket(boltBucket)
+				// keys are collected first, deleting with cursor while iterating skips keys
+				var keys [][]byte
+				cursor := bucket.Cursor()
+				for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+					if expired(value, now) {
+						keys = append(keys, append([]byte(nil), key...))
+					}
+				}
+				for _, key := range keys {
+					if err := bucket.Delete(key); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	}
+}
+
+func expired(value []byte, now time.Time) bool {
+	return len(value) != 8 || int64(binary.BigEndian.Uint64(value)) < now.UnixNano()
+}
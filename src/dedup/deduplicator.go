@@ -0,0 +1,170 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Store constants
+const (
+	StoreMemory = "memory"
+	StoreBolt   = "bolt"
+)
+
+// Reservation results, see Deduplicator.Reserve
+const (
+	// Reserved - key is reserved for the message, it should be processed
+	Reserved = iota
+	// Duplicate - message with the same key was already processed
+	Duplicate
+	// InFlight - message with the same key is being processed
+	InFlight
+)
+
+// Deduplicator - idempotency layer of strategies.
+// Keys of acknowledged messages are remembered for TTL, following messages with the same key are duplicates.
+// Keys of messages being processed are reserved, so copies processed at the same time are detected too
+type Deduplicator struct {
+	configuration Configuration
+	key           *template.Template
+	store         IStore
+	reserved      map[string]bool
+	mutex         sync.Mutex
+	logger        *log.Entry
+}
+
+// Configuration - deduplicator configuration
+type Configuration struct {
+	Key     string `default:"{{.MessageID}}"`
+	TTL     int    `default:"3600"`
+	Store   string `default:"memory"`
+	Path    string
+	MaxKeys int `default:"100000"`
+}
+
+// keyTemplateData - data available inside of Key template
+type keyTemplateData struct {
+	ID         interface{}
+	MessageID  string
+	Body       interface{}
+	Attributes map[string]string
+	Fields     map[string]interface{}
+}
+
+// Configure - configure deduplicator from decoded options
+func (d *Deduplicator) Configure(configuration Configuration, logger *log.Entry) error {
+	d.configuration = configuration
+
+	if d.configuration.TTL <= 0 {
+		return errors.New("TTL setting should be > 0")
+	}
+
+	var err error
+	if d.key, err = template.New("Key").Option("missingkey=error").Parse(d.configuration.Key); err != nil {
+		return fmt.Errorf("Can't parse Key template: %s", err.Error())
+	}
+
+	switch d.configuration.Store {
+	case StoreMemory:
+		if d.configuration.MaxKeys <= 0 {
+			return errors.New("MaxKeys setting should be > 0")
+		}
+		d.store = NewMemoryStore(d.configuration.MaxKeys)
+	case StoreBolt:
+		if d.configuration.Path == "" {
+			return errors.New("Path setting is required for bolt store")
+		}
+		if d.store, err = NewBoltStore(d.configuration.Path, time.Minute); err != nil {
+			return fmt.Errorf("Can't open %s: %s", d.configuration.Path, err.Error())
+		}
+	default:
+		return fmt.Errorf("Unknown Store value [%s]", d.configuration.Store)
+	}
+
+	d.reserved = make(map[string]bool)
+	d.logger = logger
+
+	return nil
+}
+
+// Key returns deduplication key of the message. Empty key means message can't be deduplicated,
+// key referencing missing attribute or field is an error
+func (d *Deduplicator) Key(message qp.IMessage) (string, error) {
+	data := keyTemplateData{
+		ID:         message.GetID(),
+		MessageID:  qp.GetMessageID(message),
+		Body:       message.GetBody(),
+		Attributes: message.GetAttributes(),
+	}
+	switch body := message.GetBody().(type) {
+	case map[string]interface{}:
+		data.Fields = body
+	case string:
+		json.Unmarshal([]byte(body), &data.Fields)
+	}
+
+	var key bytes.Buffer
+	if err := d.key.Execute(&key, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(key.String()), nil
+}
+
+// Reserve reserves key for processing of the message unless message with the same key was already processed
+// or is being processed. Reserved key should be remembered (message acknowledged) or released afterwards
+func (d *Deduplicator) Reserve(key string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.reserved[key] {
+		return InFlight
+	}
+	if d.isDuplicate(key) {
+		return Duplicate
+	}
+	d.reserved[key] = true
+	return Reserved
+}
+
+// Release releases key of the message which was not acknowledged (rejected or returned to the queue)
+func (d *Deduplicator) Release(key string) {
+	d.mutex.Lock()
+	delete(d.reserved, key)
+	d.mutex.Unlock()
+}
+
+// isDuplicate returns true if message with the same key was already processed
+func (d *Deduplicator) isDuplicate(key string) bool {
+	seen, err := d.store.Seen(key)
+	if err != nil {
+		d.logger.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Warn("Can't check deduplication key. Message is processed")
+		return false
+	}
+	return seen
+}
+
+// Remember marks key as processed and releases its reservation
+func (d *Deduplicator) Remember(key string) {
+	if err := d.store.Remember(key, time.Duration(d.configuration.TTL)*time.Second); err != nil {
+		d.logger.WithFields(log.Fields{
+			"key":   key,
+			"error": err,
+		}).Warn("Can't store deduplication key")
+	}
+	d.Release(key)
+}
+
+// Close releases store
+func (d *Deduplicator) Close() error {
+	return d.store.Close()
+}
@@ -0,0 +1,73 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryStore - in-memory LRU store of keys. Least recently used keys are evicted when MaxKeys is reached
+type MemoryStore struct {
+	maxKeys int
+	keys    map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+type memoryEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// NewMemoryStore - constructor for MemoryStore
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	return &MemoryStore{
+		maxKeys: maxKeys,
+		keys:    make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Seen returns true if key was remembered and is not expired yet
+func (s *MemoryStore) Seen(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element, ok := s.keys[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(element.Value.(*memoryEntry).expiresAt) {
+		s.order.Remove(element)
+		delete(s.keys, key)
+		return false, nil
+	}
+	s.order.MoveToFront(element)
+	return true, nil
+}
+
+// Remember stores key for ttl
+func (s *MemoryStore) Remember(key string, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := s.keys[key]; ok {
+		element.Value.(*memoryEntry).expiresAt = expiresAt
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.keys[key] = s.order.PushFront(&memoryEntry{key: key, expiresAt: expiresAt})
+	for s.order.Len() > s.maxKeys {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// Close - nothing to release
+func (s *MemoryStore) Close() error {
+	return nil
+}
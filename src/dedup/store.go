@@ -0,0 +1,10 @@
+package dedup
+
+import "time"
+
+// IStore - storage of processed message keys
+type IStore interface {
+	Seen(key string) (bool, error)
+	Remember(key string, ttl time.Duration) error
+	Close() error
+}
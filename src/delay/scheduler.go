@@ -0,0 +1,129 @@
+package delay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iVariable/qp/src/qp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scheduler - calculates time when message is due for processing:
+// "not before" timestamp from message attribute or body field and/or fixed delay after enqueue
+type Scheduler struct {
+	configuration Configuration
+}
+
+// Configuration - scheduler configuration
+type Configuration struct {
+	NotBeforeAttribute string
+	NotBeforeField     string
+	ProcessingDelay    int
+}
+
+// NewScheduler - constructor for Scheduler
+func NewScheduler(configuration Configuration) (*Scheduler, error) {
+	if configuration.NotBeforeAttribute != "" && configuration.NotBeforeField != "" {
+		return nil, errors.New("Only one of NotBeforeAttribute and NotBeforeField can be set")
+	}
+	if configuration.ProcessingDelay < 0 {
+		return nil, errors.New("ProcessingDelay should be >= 0")
+	}
+	return &Scheduler{configuration: configuration}, nil
+}
+
+// IsEnabled returns true if any delay is configured
+func (s *Scheduler) IsEnabled() bool {
+	return s.configuration.NotBeforeAttribute != "" || s.configuration.NotBeforeField != "" || s.configuration.ProcessingDelay > 0
+}
+
+// DueAt returns time when message should be processed. receivedAt is used if message enqueue time is unknown
+func (s *Scheduler) DueAt(message qp.IMessage, receivedAt time.Time) (time.Time, error) {
+	var dueAt time.Time
+
+	if s.configuration.ProcessingDelay > 0 {
+		enqueuedAt := qp.GetEnqueuedAt(message)
+		if enqueuedAt.IsZero() {
+			enqueuedAt = receivedAt
+		}
+		dueAt = enqueuedAt.Add(time.Duration(s.configuration.ProcessingDelay) * time.Second)
+	}
+
+	var value interface{}
+	var ok bool
+	switch {
+	case s.configuration.NotBeforeAttribute != "":
+		value, ok = message.GetAttributes()[s.configuration.NotBeforeAttribute]
+	case s.configuration.NotBeforeField != "":
+		value, ok = lookupField(message.GetBody(), s.configuration.NotBeforeField)
+	}
+	if !ok {
+		return dueAt, nil
+	}
+
+	notBefore, err := parseTimestamp(value)
+	if err != nil {
+		return dueAt, err
+	}
+	if notBefore.After(dueAt) {
+		dueAt = notBefore
+	}
+	return dueAt, nil
+}
+
+// lookupField returns value of dot-separated path of JSON body
+func lookupField(body interface{}, path string) (interface{}, bool) {
+	switch value := body.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(value), &body); err != nil {
+			return nil, false
+		}
+	case []byte:
+		if err := json.Unmarshal(value, &body); err != nil {
+			return nil, false
+		}
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := body.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if body, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return body, body != nil
+}
+
+// parseTimestamp parses unix timestamp (seconds or milliseconds) or RFC3339 date
+func parseTimestamp(value interface{}) (time.Time, error) {
+	var number float64
+	switch typed := value.(type) {
+	case float64:
+		number = typed
+	case int:
+		number = float64(typed)
+	case int64:
+		number = float64(typed)
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(typed), 64)
+		if err != nil {
+			date, err := time.Parse(time.RFC3339, strings.TrimSpace(typed))
+			if err != nil {
+				return time.Time{}, fmt.Errorf("Can't parse timestamp [%s]", typed)
+			}
+			return date, nil
+		}
+		number = parsed
+	default:
+		return time.Time{}, fmt.Errorf("Can't parse timestamp [%v]", value)
+	}
+
+	if number > 1e12 { // milliseconds
+		return time.Unix(0, int64(number*float64(time.Millisecond))), nil
+	}
+	return time.Unix(0, int64(number*float64(time.Second))), nil
+}
@@ -0,0 +1,117 @@
+package delay
+
+import (
+	"container/heap"
+	"github.com/iVariable/qp/src/qp"
+	"sync"
+	"time"
+)
+
+// Timers - local timer queue. Holds jobs until they are due and passes them to Due() channel
+type Timers struct {
+	items timerHeap
+	mutex sync.Mutex
+	wake  chan bool
+	due   chan *qp.SimpleJob
+	stop  chan bool
+}
+
+type timerItem struct {
+	job   *qp.SimpleJob
+	dueAt time.Time
+}
+
+type timerHeap []timerItem
+
+func (h timerHeap) Len() int            { return len(h) }
+func (h timerHeap) Less(i, j int) bool  { return h[i].dueAt.Before(h[j].dueAt) }
+func (h timerHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *timerHeap) Push(x interface{}) { *h = append(*h, x.(timerItem)) }
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// NewTimers - constructor for Timers, starts timer goroutine
+func NewTimers() *Timers {
+	t := &Timers{
+		wake: make(chan bool, 1),
+		due:  make(chan *qp.SimpleJob),
+		stop: make(chan bool),
+	}
+	go t.run()
+	return t
+}
+
+// Hold holds job until dueAt
+func (t *Timers) Hold(job *qp.SimpleJob, dueAt time.Time) {
+	t.mutex.Lock()
+	heap.Push(&t.items, timerItem{job: job, dueAt: dueAt})
+	t.mutex.Unlock()
+
+	select {
+	case t.wake <- true:
+	default:
+	}
+}
+
+// Due returns channel of jobs which are due
+func (t *Timers) Due() <-chan *qp.SimpleJob {
+	return t.due
+}
+
+// Len returns number of held jobs
+func (t *Timers) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.items)
+}
+
+// Stop stops timers and returns jobs which were still held
+func (t *Timers) Stop() []*qp.SimpleJob {
+	close(t.stop)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	jobs := make([]*qp.SimpleJob, 0, len(t.items))
+	for _, item := range t.items {
+		jobs = append(jobs, item.job)
+	}
+	t.items = nil
+	return jobs
+}
+
+func (t *Timers) run() {
+	for {
+		var timer <-chan time.Time
+		t.mutex.Lock()
+		if len(t.items) > 0 {
+			timer = time.After(time.Until(t.items[0].dueAt))
+		}
+		t.mutex.Unlock()
+
+		select {
+		case <-t.stop:
+			return
+		case <-t.wake:
+		case <-timer:
+			t.mutex.Lock()
+			var item timerItem
+			due := len(t.items) > 0 && !t.items[0].dueAt.After(time.Now())
+			if due {
+				item = heap.Pop(&t.items).(timerItem)
+			}
+			t.mutex.Unlock()
+
+			if due {
+				select {
+				case t.due <- item.job:
+				case <-t.stop:
+					return
+				}
+			}
+		}
+	}
+}
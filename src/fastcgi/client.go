@@ -0,0 +1,309 @@
+package fastcgi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FastCGI record types and constants, see http://www.mit.edu/~yandros/doc/specs/fcgi-spec.html
+const (
+	typeBeginRequest = 1
+	typeEndRequest   = 3
+	typeParams       = 4
+	typeStdin        = 5
+	typeStdout       = 6
+	typeStderr       = 7
+
+	roleResponder = 1
+	flagKeepConn  = 1
+
+	protocolVersion  = 1
+	requestID        = 1
+	maxContentLength = 65535
+)
+
+// Client - FastCGI client with pool of kept-alive connections.
+// Each connection handles one request at a time
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+	idle    chan net.Conn
+}
+
+// Response - FastCGI responder response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Stderr     []byte
+}
+
+type header struct {
+	Version       uint8
+	Type          uint8
+	ID            uint16
+	ContentLength uint16
+	PaddingLength uint8
+	Reserved      uint8
+}
+
+// NewClient - constructor for Client.
+// address is either "host:port" or "unix:/path/to/socket"
+func NewClient(address string, maxIdleConnections int, timeout time.Duration) *Client {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix:") {
+		network = "unix"
+		address = strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//")
+	}
+	return &Client{
+		network: network,
+		address: address,
+		timeout: timeout,
+		idle:    make(chan net.Conn, maxIdleConnections),
+	}
+}
+
+// Do sends request with params and body and reads the whole response.
+// Cancelled ctx interrupts the request, ctx deadline is honored together with client timeout
+func (c *Client) Do(ctx context.Context, params map[string]string, body []byte) (*Response, error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0)) // unblocks pending reads and writes
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	response, err := c.do(ctx, conn, params, body)
+	// watcher is stopped before connection is reused, connection with deadline set by it is discarded
+	close(done)
+	if <-interrupted || err != nil {
+		conn.Close()
+	} else {
+		c.release(conn)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// Close closes all idle connections
+func (c *Client) Close() {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (c *Client) connection(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+		dialer := net.Dialer{Timeout: c.timeout}
+		return dialer.DialContext(ctx, c.network, c.address)
+	}
+}
+
+func (c *Client) release(conn net.Conn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (c *Client) do(ctx context.Context, conn net.Conn, params map[string]string, body []byte) (*Response, error) {
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	writer := bufio.NewWriter(conn)
+
+	begin := []byte{0, roleResponder, flagKeepConn, 0, 0, 0, 0, 0}
+	if err := writeRecord(writer, typeBeginRequest, begin); err != nil {
+		return nil, err
+	}
+
+	if err := writeStream(writer, typeParams, encodeParams(params)); err != nil {
+		return nil, err
+	}
+
+	if err := writeStream(writer, typeStdin, body); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	reader := bufio.NewReader(conn)
+	for {
+		h, content, err := readRecord(reader)
+		if err != nil {
+			return nil, err
+		}
+		if h.ID != requestID {
+			return nil, fmt.Errorf("Unexpected FastCGI request id %d", h.ID)
+		}
+
+		switch h.Type {
+		case typeStdout:
+			stdout.Write(content)
+		case typeStderr:
+			stderr.Write(content)
+		case typeEndRequest:
+			if len(content) < 5 {
+				return nil, errors.New("Malformed FastCGI END_REQUEST record")
+			}
+			if protocolStatus := content[4]; protocolStatus != 0 {
+				return nil, fmt.Errorf("FastCGI request was not completed, protocol status %d", protocolStatus)
+			}
+			response, err := parseResponse(stdout.Bytes())
+			if err != nil {
+				return nil, err
+			}
+			response.Stderr = stderr.Bytes()
+			return response, nil
+		default:
+			return nil, fmt.Errorf("Unexpected FastCGI record type %d", h.Type)
+		}
+	}
+}
+
+// parseResponse parses CGI response: headers, empty line, body
+func parseResponse(stdout []byte) (*Response, error) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(stdout)))
+	mimeHeader, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Malformed CGI response headers: %s", err.Error())
+	}
+
+	response := &Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header(mimeHeader),
+	}
+
+	if status := response.Header.Get("Status"); status != "" {
+		code, err := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("Malformed CGI response status: %s", status)
+		}
+		response.StatusCode = code
+	}
+
+	body, err := ioutil.ReadAll(reader.R)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = body
+
+	return response, nil
+}
+
+// writeStream writes content split into records followed by empty record
+func writeStream(w io.Writer, recordType uint8, content []byte) error {
+	for len(content) > 0 {
+		chunk := content
+		if len(chunk) > maxContentLength {
+			chunk = chunk[:maxContentLength]
+		}
+		if err := writeRecord(w, recordType, chunk); err != nil {
+			return err
+		}
+		content = content[len(chunk):]
+	}
+	return writeRecord(w, recordType, nil)
+}
+
+func writeRecord(w io.Writer, recordType uint8, content []byte) error {
+	padding := uint8(-len(content) & 7)
+	h := header{
+		Version:       protocolVersion,
+		Type:          recordType,
+		ID:            requestID,
+		ContentLength: uint16(len(content)),
+		PaddingLength: padding,
+	}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, padding))
+	return err
+}
+
+func readRecord(r io.Reader) (header, []byte, error) {
+	var h header
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		return h, nil, err
+	}
+	if h.Version != protocolVersion {
+		return h, nil, fmt.Errorf("Unsupported FastCGI version %d", h.Version)
+	}
+	content := make([]byte, int(h.ContentLength)+int(h.PaddingLength))
+	if _, err := io.ReadFull(r, content); err != nil {
+		return h, nil, err
+	}
+	return h, content[:h.ContentLength], nil
+}
+
+func encodeParams(params map[string]string) []byte {
+	var buffer bytes.Buffer
+	for name, value := range params {
+		writeLength(&buffer, len(name))
+		writeLength(&buffer, len(value))
+		buffer.WriteString(name)
+		buffer.WriteString(value)
+	}
+	return buffer.Bytes()
+}
+
+func writeLength(buffer *bytes.Buffer, length int) {
+	if length < 128 {
+		buffer.WriteByte(byte(length))
+		return
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(length)|1<<31)
+	buffer.Write(b[:])
+}
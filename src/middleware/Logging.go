@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+)
+
+// Logging - logs every job passing thru
+type Logging struct {
+	logger *log.Entry
+}
+
+// Wrap - wrap processing function
+func (l *Logging) Wrap(next qp.ProcessFunc) qp.ProcessFunc {
+	return func(ctx context.Context, job qp.IJob) error {
+		logger := qp.JobLogger(ctx, l.logger).WithField(qp.LogFieldMessageID, job.GetMessage().GetID())
+		logger.Info("Job started")
+		err := next(ctx, job)
+		if deferred, ok := job.(*qp.DeferredJob); ok {
+			logger = logger.WithField("verdict", deferred.GetVerdict())
+		}
+		if err != nil {
+			logger.WithField("error", err).Info("Job finished with error")
+		} else {
+			logger.Info("Job finished")
+		}
+		return err
+	}
+}
+
+// Configure - configure middleware
+func (l *Logging) Configure(configuration map[string]interface{}) error {
+	l.logger = log.WithFields(log.Fields{
+		"type":       "middleware",
+		"middleware": "Logging",
+	})
+	l.logger.Info("Configuration loaded")
+	return nil
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"time"
+)
+
+// Retry - repeats processing in place when it asks for retry (qp.RetryError).
+// When retries are exhausted qp.RetryError is passed further (to the strategy)
+type Retry struct {
+	configuration retryConfiguration
+	logger        *log.Entry
+}
+
+type retryConfiguration struct {
+	MaxRetries int
+	// RetryDelay - seconds between attempts unless processor asks for its own delay, same unit as RetryDelay of strategy
+	RetryDelay int
+}
+
+// Wrap - wrap processing function
+func (r *Retry) Wrap(next qp.ProcessFunc) qp.ProcessFunc {
+	return func(ctx context.Context, job qp.IJob) error {
+		for attempt := 1; ; attempt++ {
+			err := next(ctx, job)
+			retry, ok := err.(*qp.RetryError)
+			if !ok || attempt > r.configuration.MaxRetries {
+				return err
+			}
+
+			delay := retry.After
+			if delay == 0 {
+				delay = time.Duration(r.configuration.RetryDelay) * time.Second
+			}
+			qp.JobLogger(ctx, r.logger).WithFields(log.Fields{
+				qp.LogFieldMessageID: job.GetMessage().GetID(),
+				"attempt":            attempt,
+				"delay":              delay,
+			}).Debug("Retrying")
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+	}
+}
+
+// Options returns options struct of the middleware
+func (r *Retry) Options() interface{} {
+	return &retryConfiguration{}
+}
+
+// Configure - configure middleware
+func (r *Retry) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &r.configuration); err != nil {
+		return err
+	}
+	if r.configuration.MaxRetries < 0 || r.configuration.RetryDelay < 0 {
+		return errors.New("MaxRetries and RetryDelay settings for Retry should be >= 0")
+	}
+	r.logger = log.WithFields(log.Fields{
+		"type":       "middleware",
+		"middleware": "Retry",
+	})
+	r.logger.WithField("configuration", r.configuration).Info("Configuration loaded")
+	return nil
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"time"
+)
+
+// Timing - logs job processing duration. Jobs slower than WarnAfter milliseconds are logged as warnings
+type Timing struct {
+	configuration timingConfiguration
+	logger        *log.Entry
+}
+
+type timingConfiguration struct {
+	WarnAfter int
+}
+
+// Wrap - wrap processing function
+func (t *Timing) Wrap(next qp.ProcessFunc) qp.ProcessFunc {
+	return func(ctx context.Context, job qp.IJob) error {
+		startedAt := time.Now()
+		err := next(ctx, job)
+		duration := time.Since(startedAt)
+
+		logger := qp.JobLogger(ctx, t.logger).WithFields(log.Fields{
+			qp.LogFieldMessageID: job.GetMessage().GetID(),
+			qp.LogFieldDuration:  duration,
+		})
+		if t.configuration.WarnAfter > 0 && duration > time.Duration(t.configuration.WarnAfter)*time.Millisecond {
+			logger.Warn("Slow job")
+		} else {
+			logger.Debug("Job timing")
+		}
+		return err
+	}
+}
+
+// Options returns options struct of the middleware
+func (t *Timing) Options() interface{} {
+	return &timingConfiguration{}
+}
+
+// Configure - configure middleware
+func (t *Timing) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &t.configuration); err != nil {
+		return err
+	}
+	t.logger = log.WithFields(log.Fields{
+		"type":       "middleware",
+		"middleware": "Timing",
+	})
+	t.logger.WithField("configuration", t.configuration).Info("Configuration loaded")
+	return nil
+}
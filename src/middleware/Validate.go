@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/validation"
+)
+
+// Validate - validates message body against JSON Schema before processing.
+// Invalid message is rejected (or dead-lettered) and never reaches the wrapped processing
+type Validate struct {
+	validator validation.Validator
+	logger    *log.Entry
+}
+
+// Wrap - wrap processing function
+func (v *Validate) Wrap(next qp.ProcessFunc) qp.ProcessFunc {
+	return func(ctx context.Context, job qp.IJob) error {
+		if errs := v.validator.Validate(job.GetMessage()); len(errs) > 0 {
+			return v.validator.HandleInvalid(ctx, job, errs)
+		}
+		return next(ctx, job)
+	}
+}
+
+// Link - resolve dead-letter queue
+func (v *Validate) Link(context *qp.Context) error {
+	return v.validator.Link(context)
+}
+
+// Options returns options struct of the middleware
+func (v *Validate) Options() interface{} {
+	return &validation.Configuration{}
+}
+
+// Configure - configure middleware
+func (v *Validate) Configure(configuration map[string]interface{}) error {
+	v.logger = log.WithFields(log.Fields{
+		"type":       "middleware",
+		"middleware": "Validate",
+	})
+	if err := v.validator.Configure(configuration, v.logger); err != nil {
+		return err
+	}
+	v.logger.WithField("configuration", configuration).Info("Configuration loaded")
+	return nil
+}
@@ -0,0 +1,251 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"strings"
+	"sync"
+)
+
+// FanOut ack rule constants
+const (
+	FanOutAckAll     = "all"
+	FanOutAckAny     = "any"
+	FanOutAckPrimary = "primary"
+)
+
+// FanOut - sends job to several processors (branches) concurrently.
+// Branches ack/reject only recorded, real message is acknowledged or rejected once by FanOut according to AckRule:
+// all - all branches must acknowledge, any - at least one branch, primary - Primary branch.
+// If rule is not satisfied and one of the deciding branches asked for retry - whole job is retried by strategy,
+// branches which acknowledged the job are not run again on retry (see qp.IValuesAwareJob)
+type FanOut struct {
+	configuration fanOutConfiguration
+	branches      []fanOutBranch
+	logger        *log.Entry
+}
+
+type fanOutConfiguration struct {
+	Branches []string `ref:"processor"`
+	AckRule  string   `default:"all"`
+	Primary  string
+}
+
+type fanOutBranch struct {
+	name      string
+	processor qp.IProcessor
+}
+
+type fanOutResult struct {
+	branch string
+	acked  bool
+	retry  *qp.RetryError
+	reason string
+}
+
+// Process - Process job
+func (f *FanOut) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, f.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	acknowledged := f.acknowledgedBranches(job)
+	results := make([]fanOutResult, len(f.branches))
+	var wait sync.WaitGroup
+	for i, branch := range f.branches {
+		if acknowledged[i] {
+			logger.WithField("branch", branch.name).Debug("Branch acknowledged on previous attempt. Skipped")
+			results[i] = fanOutResult{branch: branch.name, acked: true}
+			continue
+		}
+		wait.Add(1)
+		go func(i int, branch fanOutBranch) {
+			defer wait.Done()
+			results[i] = f.runBranch(ctx, branch, job)
+		}(i, branch)
+	}
+	wait.Wait()
+
+	var deciding []fanOutResult
+	for _, result := range results {
+		if f.configuration.AckRule != FanOutAckPrimary || result.branch == f.configuration.Primary {
+			deciding = append(deciding, result)
+		}
+	}
+
+	acked := 0
+	var retry *qp.RetryError
+	var reasons []string
+	for _, result := range deciding {
+		switch {
+		case result.acked:
+			acked++
+		case result.retry != nil:
+			if retry == nil || result.retry.After > retry.After {
+				retry = result.retry
+			}
+			reasons = append(reasons, result.branch+": "+result.retry.Error())
+		default:
+			reasons = append(reasons, result.branch+": "+result.reason)
+		}
+	}
+
+	satisfied := acked == len(deciding)
+	if f.configuration.AckRule == FanOutAckAny {
+		satisfied = acked > 0
+	}
+
+	if retry == nil || satisfied {
+		f.rememberAcknowledged(job, nil)
+	}
+
+	if satisfied {
+		if ackError := job.AckMessage(); ackError != nil {
+			logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+			return ackError
+		}
+		logger.WithField("acked", acked).Debug("Job acknowledged")
+		return nil
+	}
+
+	if retry != nil {
+		for i, result := range results {
+			acknowledged[i] = result.acked
+		}
+		f.rememberAcknowledged(job, acknowledged)
+		logger.WithField("reasons", reasons).Debug("Job retry requested")
+		return qp.NewRetryError(errors.New(strings.Join(reasons, "; ")), retry.After)
+	}
+
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(strings.Join(reasons, "\n"))
+	}
+	if rejectError := job.RejectMessage(); rejectError != nil {
+		logger.WithError(rejectError).Debug("Error on MessageReject")
+		return rejectError
+	}
+	logger.WithField("reasons", reasons).Debug("Job rejected")
+	return nil
+}
+
+// valuesKey - key of branches acknowledged on previous attempts in job values, unique per FanOut
+func (f *FanOut) valuesKey() string {
+	return fmt.Sprintf("FanOut.%p.acknowledged", f)
+}
+
+// acknowledgedBranches returns branches which acknowledged the job on previous attempts
+func (f *FanOut) acknowledgedBranches(job qp.IJob) []bool {
+	if valuesAware, ok := job.(qp.IValuesAwareJob); ok {
+		if acknowledged, ok := valuesAware.GetValue(f.valuesKey()).([]bool); ok && len(acknowledged) == len(f.branches) {
+			return acknowledged
+		}
+	}
+	return make([]bool, len(f.branches))
+}
+
+// rememberAcknowledged stores branches which acknowledged the job for the next attempt, nil forgets them
+func (f *FanOut) rememberAcknowledged(job qp.IJob, acknowledged []bool) {
+	if valuesAware, ok := job.(qp.IValuesAwareJob); ok {
+		if acknowledged == nil {
+			valuesAware.SetValue(f.valuesKey(), nil)
+		} else {
+			valuesAware.SetValue(f.valuesKey(), acknowledged)
+		}
+	}
+}
+
+func (f *FanOut) runBranch(ctx context.Context, branch fanOutBranch, job qp.IJob) fanOutResult {
+	logger := qp.JobLogger(ctx, f.logger)
+	branchJob := qp.NewDeferredJob(job)
+	err := branch.processor.Process(ctx, branchJob)
+
+	result := fanOutResult{branch: branch.name}
+	if retry, ok := err.(*qp.RetryError); ok {
+		result.retry = retry
+		return result
+	}
+	if err != nil {
+		result.reason = err.Error()
+		return result
+	}
+
+	switch branchJob.GetVerdict() {
+	case qp.VerdictAck, qp.VerdictDeadLetter:
+		result.acked = true
+	case qp.VerdictReject:
+		result.reason = branchJob.GetFailureReason()
+		if result.reason == "" {
+			result.reason = "rejected"
+		}
+	default:
+		result.reason = "neither acknowledged nor rejected"
+	}
+
+	logger.WithFields(log.Fields{
+		"branch":  branch.name,
+		"verdict": branchJob.GetVerdict(),
+	}).Debug("Branch finished")
+
+	return result
+}
+
+// Link - resolve branch processors
+func (f *FanOut) Link(context *qp.Context) error {
+	f.branches = nil
+	for _, name := range f.configuration.Branches {
+		processor, ok := context.AvailableProcessors[name]
+		if !ok {
+			return fmt.Errorf("Unknown processor [%s] requested for FanOut branch", name)
+		}
+		if *processor == qp.IProcessor(f) {
+			return errors.New("FanOut can not use itself as a branch")
+		}
+		f.branches = append(f.branches, fanOutBranch{
+			name:      name,
+			processor: *processor,
+		})
+	}
+	return nil
+}
+
+// Options returns options struct of the processor
+func (f *FanOut) Options() interface{} {
+	return &fanOutConfiguration{}
+}
+
+// Configure - configure processor
+func (f *FanOut) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &f.configuration); err != nil {
+		return err
+	}
+
+	if len(f.configuration.Branches) == 0 {
+		return errors.New("FanOut should have at least one branch")
+	}
+
+	switch f.configuration.AckRule {
+	case FanOutAckAll, FanOutAckAny:
+	case FanOutAckPrimary:
+		found := false
+		for _, name := range f.configuration.Branches {
+			found = found || name == f.configuration.Primary
+		}
+		if !found {
+			return errors.New("Primary setting for FanOut should be one of Branches")
+		}
+	default:
+		return fmt.Errorf("Unknown AckRule [%s] for FanOut", f.configuration.AckRule)
+	}
+
+	f.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "FanOut",
+	})
+
+	f.logger.WithField("configuration", f.configuration).Info("Configuration loaded")
+
+	return nil
+}
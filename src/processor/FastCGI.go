@@ -0,0 +1,199 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/fastcgi"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FastCGI - send message directly to FastCGI application (e.g. PHP-FPM pool)
+// Acknowledge message in case response status is one of AckStatusCodes (200 by default)
+// Status from RetryStatusCodes or connection error - job is retried by strategy
+// Any other status - reject
+type FastCGI struct {
+	configuration  fastCGIConfiguration
+	client         *fastcgi.Client
+	scriptFilename *template.Template
+	params         map[string]*template.Template
+	body           *template.Template
+	logger         *log.Entry
+}
+
+type fastCGIConfiguration struct {
+	Address          string `required:"true"`
+	ScriptFilename   string `required:"true"`
+	Params           map[string]string
+	Body             string
+	Timeout          int
+	MaxConnections   int   `default:"1"`
+	AckStatusCodes   []int `default:"200"`
+	RetryStatusCodes []int
+}
+
+// Process - Process job
+func (f *FastCGI) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, f.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	params, body, err := f.buildRequest(job.GetMessage())
+	if err != nil {
+		logger.WithField("error", err).Error("Error during request rendering")
+		return err
+	}
+	if correlationID := qp.CorrelationID(ctx); correlationID != "" {
+		params["HTTP_X_CORRELATION_ID"] = correlationID
+	}
+	for name, value := range qp.TraceContextFields(ctx) {
+		params["HTTP_"+strings.ToUpper(name)] = value
+	}
+
+	response, err := f.client.Do(ctx, params, body)
+	if err != nil && ctx.Err() != nil {
+		logger.WithError(err).Debug("FastCGI request cancelled")
+		return err
+	}
+	if err != nil {
+		logger.WithError(err).Debug("FastCGI request failed")
+		return qp.NewRetryError(err, 0)
+	}
+
+	if len(response.Stderr) > 0 {
+		logger.WithField("stderr", string(response.Stderr)).Info("FastCGI application stderr")
+	}
+
+	switch {
+	case containsCode(f.configuration.AckStatusCodes, response.StatusCode):
+		if ackError := job.AckMessage(); ackError != nil {
+			logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+			return ackError
+		}
+		logger.Debug("Job acknowledged")
+		return nil
+	case containsCode(f.configuration.RetryStatusCodes, response.StatusCode):
+		logger.WithField("status", response.StatusCode).Debug("Job retry requested")
+		return qp.NewRetryError(fmt.Errorf("Response status is %d", response.StatusCode), 0)
+	}
+
+	reason := fmt.Sprintf("Response status is %d", response.StatusCode)
+	if len(response.Stderr) > 0 {
+		reason += "\n" + strings.TrimSpace(string(response.Stderr))
+	}
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+	if rejectError := job.RejectMessage(); rejectError != nil {
+		logger.WithError(rejectError).Debug("Error on MessageReject")
+		return rejectError
+	}
+	logger.WithField("status", response.StatusCode).Debug("Job rejected")
+	return nil
+}
+
+// buildRequest renders FastCGI params and request body for the message
+func (f *FastCGI) buildRequest(message qp.IMessage) (map[string]string, []byte, error) {
+	data := newMessageTemplateData(message)
+
+	var body string
+	var err error
+	if f.body != nil {
+		body, err = renderTemplate(f.body, data)
+	} else {
+		body, err = message.Serialize()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scriptFilename, err := renderTemplate(f.scriptFilename, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := map[string]string{
+		"GATEWAY_INTERFACE": "FastCGI/1.0",
+		"SERVER_SOFTWARE":   "qp",
+		"SERVER_PROTOCOL":   "HTTP/1.1",
+		"REQUEST_METHOD":    "POST",
+		"SCRIPT_FILENAME":   scriptFilename,
+		"SCRIPT_NAME":       "/" + filepath.Base(scriptFilename),
+		"REQUEST_URI":       "/" + filepath.Base(scriptFilename),
+		"CONTENT_TYPE":      "application/json",
+		"CONTENT_LENGTH":    strconv.Itoa(len(body)),
+	}
+
+	for name, t := range f.params {
+		if params[name], err = renderTemplate(t, data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return params, []byte(body), nil
+}
+
+// Close closes idle connections to FastCGI application
+func (f *FastCGI) Close() error {
+	f.client.Close()
+	return nil
+}
+
+// Options returns options struct of the processor
+func (f *FastCGI) Options() interface{} {
+	return &fastCGIConfiguration{}
+}
+
+// Configure - configure processor
+func (f *FastCGI) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &f.configuration); err != nil {
+		return err
+	}
+
+	if f.configuration.Address == "" {
+		return errors.New("Address setting for FastCGI should not be empty")
+	}
+	if f.configuration.ScriptFilename == "" {
+		return errors.New("ScriptFilename setting for FastCGI should not be empty")
+	}
+	if f.configuration.Timeout < 0 {
+		return errors.New("Timeout setting for FastCGI should be >= 0")
+	}
+	if f.configuration.MaxConnections <= 0 {
+		return errors.New("MaxConnections setting for FastCGI should be > 0")
+	}
+
+	var err error
+	if f.scriptFilename, err = parseTemplate("ScriptFilename", f.configuration.ScriptFilename); err != nil {
+		return err
+	}
+	if f.configuration.Body != "" {
+		if f.body, err = parseTemplate("Body", f.configuration.Body); err != nil {
+			return err
+		}
+	}
+	if f.params, err = parseTemplates("Params", f.configuration.Params); err != nil {
+		return err
+	}
+
+	f.client = fastcgi.NewClient(
+		f.configuration.Address,
+		f.configuration.MaxConnections,
+		time.Duration(f.configuration.Timeout)*time.Second,
+	)
+
+	f.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "FastCGI",
+	})
+
+	f.logger.WithField("configuration", f.configuration).Info("Configuration loaded")
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package processor
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/qpgrpc"
+	"github.com/iVariable/qp/src/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GRPC - call Process method of qp.Processor service (see src/qpgrpc/processor.proto)
+// Verdict ACK - acknowledge message, RETRY - job is retried by strategy
+// REJECT or any other verdict - reject
+type GRPC struct {
+	configuration gRPCConfiguration
+	connection    *grpc.ClientConn
+	logger        *log.Entry
+}
+
+type gRPCConfiguration struct {
+	Target       string `required:"true"`
+	TLS          bool
+	Timeout      int
+	Retries      int
+	RetryBackoff int `default:"1"`
+}
+
+// Process - Process job
+func (g *GRPC) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, g.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	request, err := g.buildJob(job)
+	if err != nil {
+		logger.WithError(err).Error("Error during message serialization")
+		return err
+	}
+
+	md := metadata.Pairs(
+		"qp-message-id", request.ID,
+		"qp-attempt", strconv.Itoa(int(request.Attempt)),
+	)
+	for name, value := range request.Attributes {
+		md.Append(grpcMetadataKey("qp-attr-"+name, value), value)
+	}
+	if correlationID := qp.CorrelationID(ctx); correlationID != "" {
+		md.Append(strings.ToLower(CorrelationIDHeader), correlationID)
+	}
+	for name, value := range qp.TraceContextFields(ctx) {
+		md.Set(name, value)
+	}
+
+	var verdict qpgrpc.Verdict
+	for attempt := 0; ; attempt++ {
+		verdict = qpgrpc.Verdict{}
+		err = g.invoke(ctx, md, request, &verdict)
+		if err == nil || !isTransientGRPCError(err) || attempt >= g.configuration.Retries {
+			break
+		}
+		logger.WithError(err).WithField("attempt", attempt+1).Debug("GRPC call failed. Retrying")
+		select {
+		case <-time.After(time.Duration(g.configuration.RetryBackoff*(attempt+1)) * time.Second):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err != nil && ctx.Err() != nil {
+		logger.WithError(err).Debug("GRPC call cancelled")
+		return ctx.Err()
+	}
+
+	if err != nil {
+		logger.WithError(err).Debug("GRPC call failed")
+		if isTransientGRPCError(err) {
+			return qp.NewRetryError(err, 0)
+		}
+		return g.reject(job, err.Error())
+	}
+
+	switch verdict.Action {
+	case qpgrpc.ActionAck:
+		if ackError := job.AckMessage(); ackError != nil {
+			logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+			return ackError
+		}
+		logger.Debug("Job acknowledged")
+		return nil
+	case qpgrpc.ActionRetry:
+		logger.WithField("reason", verdict.Reason).Debug("Job retry requested")
+		return qp.NewRetryError(errors.New(verdict.Reason), time.Duration(verdict.RetryAfterMs)*time.Millisecond)
+	case qpgrpc.ActionReject:
+		return g.reject(job, verdict.Reason)
+	default:
+		return g.reject(job, fmt.Sprintf("Unknown verdict action [%d] received", verdict.Action))
+	}
+}
+
+func (g *GRPC) invoke(ctx context.Context, md metadata.MD, request *qpgrpc.Job, verdict *qpgrpc.Verdict) error {
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	if g.configuration.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(g.configuration.Timeout)*time.Second)
+		defer cancel()
+	}
+	return g.connection.Invoke(ctx, qpgrpc.ProcessMethod, request, verdict, grpc.ForceCodec(qpgrpc.Codec{}))
+}
+
+func (g *GRPC) buildJob(job qp.IJob) (*qpgrpc.Job, error) {
+	message := job.GetMessage()
+	request := &qpgrpc.Job{
+		ID:         fmt.Sprint(message.GetID()),
+		Attributes: message.GetAttributes(),
+		Attempt:    1,
+	}
+
+	switch body := message.GetBody().(type) {
+	case string:
+		request.Body = []byte(body)
+	case []byte:
+		request.Body = body
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		request.Body = encoded
+	}
+
+	if attemptAware, ok := job.(interface {
+		GetAttempt() int
+	}); ok {
+		request.Attempt = int32(attemptAware.GetAttempt())
+	}
+
+	return request, nil
+}
+
+func (g *GRPC) reject(job qp.IJob, reason string) error {
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+	if rejectError := job.RejectMessage(); rejectError != nil {
+		g.logger.WithError(rejectError).Debug("Error on MessageReject")
+		return rejectError
+	}
+	g.logger.WithField("reason", reason).Debug("Job rejected")
+	return nil
+}
+
+// grpcMetadataKey builds valid metadata key, values with non printable characters are sent as binary
+func grpcMetadataKey(name string, value string) string {
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+
+	for _, r := range value {
+		if r < 0x20 || r > 0x7E {
+			return key + "-bin"
+		}
+	}
+	return key
+}
+
+// isTransientGRPCError returns true for errors which may disappear on the next call
+func isTransientGRPCError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// Close closes connection to the service
+func (g *GRPC) Close() error {
+	return g.connection.Close()
+}
+
+// Options returns options struct of the processor
+func (g *GRPC) Options() interface{} {
+	return &gRPCConfiguration{}
+}
+
+// Configure - configure processor
+func (g *GRPC) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &g.configuration); err != nil {
+		return err
+	}
+
+	if g.configuration.Target == "" {
+		return errors.New("Target setting for GRPC should not be empty")
+	}
+	if g.configuration.Timeout < 0 || g.configuration.Retries < 0 || g.configuration.RetryBackoff < 0 {
+		return errors.New("Timeout, Retries and RetryBackoff settings for GRPC should be >= 0")
+	}
+
+	transportCredentials := insecure.NewCredentials()
+	if g.configuration.TLS {
+		transportCredentials = credentials.NewTLS(&tls.Config{})
+	}
+
+	connection, err := grpc.NewClient(g.configuration.Target, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return err
+	}
+	g.connection = connection
+
+	g.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "GRPC",
+	})
+
+	g.logger.WithField("configuration", g.configuration).Info("Configuration loaded")
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package processor
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/iVariable/qp/src/qp"
 	"github.com/iVariable/qp/src/utils"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
@@ -21,54 +24,123 @@ type HTTPProxy struct {
 
 type httpProxyConfiguration struct {
 	Timeout int
-	URL     string
+	URL     string `required:"true"`
 }
 
 // Process - Process job
-func (h *HTTPProxy) Process(job qp.IJob) error {
-	h.logger.WithField("job", job).Debug("Processing job")
+func (h *HTTPProxy) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, h.logger)
+	logger.WithField("job", job).Debug("Processing job")
 	serializedMessage, err := job.GetMessage().Serialize()
 	if err != nil {
-		h.logger.WithError(err).Error("Error during message serialization")
+		logger.WithError(err).Error("Error during message serialization")
 		return err
 	}
 
-	request, err := http.NewRequest("POST", h.configuration.URL, strings.NewReader(serializedMessage))
+	request, err := http.NewRequestWithContext(ctx, "POST", h.configuration.URL, strings.NewReader(serializedMessage))
 	if err != nil {
-		h.logger.WithError(err).Warn("Error sending HTTP request")
+		logger.WithError(err).Warn("Error sending HTTP request")
 		return err
 	}
+	if correlationID := qp.CorrelationID(ctx); correlationID != "" {
+		request.Header.Set(CorrelationIDHeader, correlationID)
+	}
+	for name, value := range qp.TraceContextFields(ctx) {
+		request.Header.Set(name, value)
+	}
 
 	resp, err := h.client.Do(request)
+	if err != nil && ctx.Err() != nil {
+		logger.WithError(err).Debug("Job cancelled")
+		return err
+	}
 
 	if err == nil && resp.StatusCode != 200 {
 		err = errors.New("Response code is not 200. It is: "+resp.Status)
 	}
 
 	if err != nil  {
-		h.logger.WithError(err).Debug("Job failed")
+		logger.WithError(err).Debug("Job failed")
 		if rejectError := job.RejectMessage(); rejectError != nil {
-			h.logger.WithError(rejectError).Debug("Error on MessageReject")
+			logger.WithError(rejectError).Debug("Error on MessageReject")
 			return rejectError
 		} else {
-			h.logger.Debug("Job rejected")
+			logger.Debug("Job rejected")
 		}
 	} else {
 		resp.Body.Close()
-		h.logger.Debug("Job Processed")
+		logger.Debug("Job Processed")
 		if ackError := job.AckMessage(); ackError != nil {
-			h.logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+			logger.WithError(ackError).Debug("Error on MessageAcknowledge")
 			return ackError
 		}
-		h.logger.Debug("Job acknowledged")
+		logger.Debug("Job acknowledged")
 	}
 
 	return nil
 }
 
+// ProcessBatch - Process batch of jobs. Sends JSON array of message bodies in one POST request.
+// On response code 200 response body may hold JSON array of per-item results, otherwise all jobs are acknowledged.
+// Any other response code - all jobs are rejected. Batch is retried if request could not be sent
+func (h *HTTPProxy) ProcessBatch(ctx context.Context, jobs []qp.IJob) error {
+	logger := qp.JobLogger(ctx, h.logger)
+	logger.WithField("jobs", len(jobs)).Debug("Processing batch")
+	body, err := batchBody(jobs)
+	if err != nil {
+		logger.WithError(err).Error("Error during batch serialization")
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", h.configuration.URL, bytes.NewReader(body))
+	if err != nil {
+		logger.WithError(err).Warn("Error sending HTTP request")
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if correlationID := qp.CorrelationID(ctx); correlationID != "" {
+		request.Header.Set(CorrelationIDHeader, correlationID)
+	}
+	for name, value := range qp.TraceContextFields(ctx) {
+		request.Header.Set(name, value)
+	}
+
+	resp, err := h.client.Do(request)
+	if err != nil && ctx.Err() != nil {
+		logger.WithError(err).Debug("Batch cancelled")
+		return err
+	}
+	if err != nil {
+		logger.WithError(err).Debug("Batch failed. It will be retried")
+		return qp.NewRetryError(err, 0)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		reason := "Response code is not 200. It is: " + resp.Status
+		logger.WithField("reason", reason).Debug("Batch failed")
+		return resolveBatchWith(jobs, BatchVerdictReject, reason, logger)
+	}
+
+	output, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		if results, ok := parseBatchResults(output, len(jobs)); ok {
+			return resolveBatch(jobs, results, logger)
+		}
+	}
+	return resolveBatchWith(jobs, BatchVerdictAck, "", logger)
+}
+
+// Options returns options struct of the processor
+func (h *HTTPProxy) Options() interface{} {
+	return &httpProxyConfiguration{}
+}
+
 // Configure - configure processor
 func (h *HTTPProxy) Configure(configuration map[string]interface{}) error {
-	utils.FillStruct(configuration, &h.configuration)
+	if err := utils.Decode(configuration, &h.configuration); err != nil {
+		return err
+	}
 
 	if h.configuration.Timeout < 0 {
 		return errors.New("Timout setting for HttpProxy should be > 0")
@@ -0,0 +1,238 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+)
+
+// Pipeline stage outcome constants
+const (
+	PipelineOutcomeContinue = "continue"
+	PipelineOutcomeAck      = "ack"
+	PipelineOutcomeReject   = "reject"
+	PipelineOutcomeDrop     = "drop"
+)
+
+// Pipeline - passes job thru the chain of processors (stages).
+// Message rewritten by a stage (see Transform) is passed to the following stages.
+// Stages ack/reject only recorded, real message is acknowledged or rejected once by the pipeline:
+// by default stage ack continues the pipeline, stage reject rejects the message,
+// message is acknowledged after the last stage. Message dead-lettered by a stage (see Validate) is acknowledged
+// and not passed to the following stages.
+// Retry request of any stage stops the pipeline and is passed to the strategy
+type Pipeline struct {
+	configuration pipelineConfiguration
+	process       qp.ProcessFunc
+	logger        *log.Entry
+}
+
+type pipelineConfiguration struct {
+	Middleware []string `ref:"middleware"`
+	Stages     []pipelineStageConfiguration
+}
+
+type pipelineStageConfiguration struct {
+	Processor  string   `ref:"processor"`
+	Middleware []string `ref:"middleware"`
+	OnAck      string
+	OnReject   string
+}
+
+type pipelineStage struct {
+	configuration pipelineStageConfiguration
+	process       qp.ProcessFunc
+}
+
+// Process - Process job
+func (p *Pipeline) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, p.logger)
+	logger.WithField("job", job).Debug("Processing job")
+	return p.process(ctx, job)
+}
+
+// runner returns processing function running given stages
+func (p *Pipeline) runner(stages []pipelineStage) qp.ProcessFunc {
+	return func(ctx context.Context, job qp.IJob) error {
+		return p.run(ctx, stages, job)
+	}
+}
+
+// run runs stages one by one and issues the final verdict.
+// Cancelled ctx stops the pipeline before the next stage
+func (p *Pipeline) run(ctx context.Context, stages []pipelineStage, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, p.logger)
+	message := job.GetMessage()
+	defer func() {
+		// nested pipeline passes rewritten message to the outer one
+		if mutable, ok := job.(qp.IMutableJob); ok {
+			mutable.SetMessage(message)
+		}
+	}()
+
+	for _, stage := range stages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stageJob := qp.NewDeferredJob(job)
+		stageJob.SetMessage(message)
+		err := stage.process(ctx, stageJob)
+		message = stageJob.GetMessage()
+		if err != nil {
+			logger.WithFields(log.Fields{
+				"stage": stage.configuration.Processor,
+				"error": err,
+			}).Debug("Stage failed")
+			return err
+		}
+
+		if stageJob.GetVerdict() == qp.VerdictDeadLetter {
+			logger.WithField("stage", stage.configuration.Processor).Debug("Job dead-lettered")
+			if ackError := qp.AckDeadLettered(job); ackError != nil {
+				logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+				return ackError
+			}
+			return nil
+		}
+
+		outcome := PipelineOutcomeContinue
+		switch stageJob.GetVerdict() {
+		case qp.VerdictAck:
+			outcome = stage.configuration.OnAck
+		case qp.VerdictReject:
+			outcome = stage.configuration.OnReject
+		}
+
+		logger.WithFields(log.Fields{
+			"stage":   stage.configuration.Processor,
+			"verdict": stageJob.GetVerdict(),
+			"outcome": outcome,
+		}).Debug("Stage finished")
+
+		switch outcome {
+		case PipelineOutcomeAck:
+			return p.ack(job)
+		case PipelineOutcomeDrop:
+			logger.WithField("stage", stage.configuration.Processor).Debug("Job dropped")
+			return p.ack(job)
+		case PipelineOutcomeReject:
+			reason := stageJob.GetFailureReason()
+			if reason == "" {
+				reason = fmt.Sprintf("Rejected by stage %s", stage.configuration.Processor)
+			}
+			if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+				failureAware.SetFailureReason(reason)
+			}
+			if rejectError := job.RejectMessage(); rejectError != nil {
+				logger.WithError(rejectError).Debug("Error on MessageReject")
+				return rejectError
+			}
+			logger.Debug("Job rejected")
+			return nil
+		}
+	}
+
+	return p.ack(job)
+}
+
+func (p *Pipeline) ack(job qp.IJob) error {
+	if ackError := job.AckMessage(); ackError != nil {
+		p.logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+		return ackError
+	}
+	p.logger.Debug("Job acknowledged")
+	return nil
+}
+
+// Link - resolve stage processors and middleware
+func (p *Pipeline) Link(context *qp.Context) error {
+	var stages []pipelineStage
+	for _, configuration := range p.configuration.Stages {
+		processor, ok := context.AvailableProcessors[configuration.Processor]
+		if !ok {
+			return fmt.Errorf("Unknown processor [%s] requested for Pipeline stage", configuration.Processor)
+		}
+		if *processor == qp.IProcessor(p) {
+			return errors.New("Pipeline can not use itself as a stage")
+		}
+
+		process, err := wrapMiddleware(context, configuration.Middleware, (*processor).Process)
+		if err != nil {
+			return err
+		}
+
+		stages = append(stages, pipelineStage{
+			configuration: configuration,
+			process:       process,
+		})
+	}
+
+	process, err := wrapMiddleware(context, p.configuration.Middleware, p.runner(stages))
+	if err != nil {
+		return err
+	}
+	p.process = process
+
+	return nil
+}
+
+// wrapMiddleware wraps processing function with named middleware, first one is the outermost
+func wrapMiddleware(context *qp.Context, names []string, process qp.ProcessFunc) (qp.ProcessFunc, error) {
+	for i := len(names) - 1; i >= 0; i-- {
+		middleware, ok := context.AvailableMiddleware[names[i]]
+		if !ok {
+			return nil, fmt.Errorf("Unknown middleware [%s] requested", names[i])
+		}
+		process = (*middleware).Wrap(process)
+	}
+	return process, nil
+}
+
+// Options returns options struct of the processor
+func (p *Pipeline) Options() interface{} {
+	return &pipelineConfiguration{}
+}
+
+// Configure - configure processor
+func (p *Pipeline) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &p.configuration); err != nil {
+		return err
+	}
+
+	if len(p.configuration.Stages) == 0 {
+		return errors.New("Pipeline should have at least one stage")
+	}
+
+	for i := range p.configuration.Stages {
+		stage := &p.configuration.Stages[i]
+		if stage.OnAck == "" {
+			stage.OnAck = PipelineOutcomeContinue
+		}
+		if stage.OnReject == "" {
+			stage.OnReject = PipelineOutcomeReject
+		}
+		for _, outcome := range []string{stage.OnAck, stage.OnReject} {
+			switch outcome {
+			case PipelineOutcomeContinue, PipelineOutcomeAck, PipelineOutcomeReject, PipelineOutcomeDrop:
+			default:
+				return fmt.Errorf("Unknown Pipeline stage outcome [%s]", outcome)
+			}
+		}
+	}
+
+	p.process = func(ctx context.Context, job qp.IJob) error {
+		return errors.New("Pipeline is not linked")
+	}
+
+	p.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "Pipeline",
+	})
+
+	p.logger.WithField("configuration", p.configuration).Info("Configuration loaded")
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"regexp"
+	"sync"
+)
+
+// Router - passes job to the processor of the first matching rule or to Default processor.
+// Rules match on body JSON fields, message attributes and body. Job is rejected if no route found
+type Router struct {
+	configuration routerConfiguration
+	rules         []routerRule
+	defaultRoute  qp.IProcessor
+	counters      map[string]int64
+	countersMutex sync.Mutex
+	logger        *log.Entry
+}
+
+type routerConfiguration struct {
+	Rules   []routerRuleConfiguration
+	Default string `ref:"processor"`
+}
+
+type routerRuleConfiguration struct {
+	Name        string
+	Processor   string `ref:"processor"`
+	Field       string
+	Attribute   string
+	Equals      string
+	Matches     string
+	BodyMatches string
+}
+
+type routerRule struct {
+	configuration routerRuleConfiguration
+	matches       *regexp.Regexp
+	bodyMatches   *regexp.Regexp
+	processor     qp.IProcessor
+}
+
+// Process - Process job
+func (r *Router) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, r.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	data := newMessageTemplateData(job.GetMessage())
+	for _, rule := range r.rules {
+		if rule.match(job.GetMessage(), data) {
+			r.count("route." + rule.configuration.Name)
+			logger.WithField("route", rule.configuration.Name).Debug("Route found")
+			return rule.processor.Process(ctx, job)
+		}
+	}
+
+	if r.defaultRoute != nil {
+		r.count("route.default")
+		logger.Debug("Default route used")
+		return r.defaultRoute.Process(ctx, job)
+	}
+
+	r.count("route.unrouted")
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason("No route found")
+	}
+	if rejectError := job.RejectMessage(); rejectError != nil {
+		logger.WithError(rejectError).Debug("Error on MessageReject")
+		return rejectError
+	}
+	logger.Debug("No route found. Job rejected")
+	return nil
+}
+
+func (rule *routerRule) match(message qp.IMessage, data messageTemplateData) bool {
+	if rule.configuration.Field != "" || rule.configuration.Attribute != "" {
+		var value string
+		var ok bool
+		if rule.configuration.Field != "" {
+			value, ok = lookupField(data.Fields, rule.configuration.Field)
+		} else {
+			value, ok = message.GetAttributes()[rule.configuration.Attribute]
+		}
+		if !ok {
+			return false
+		}
+		if rule.configuration.Equals != "" && value != rule.configuration.Equals {
+			return false
+		}
+		if rule.matches != nil && !rule.matches.MatchString(value) {
+			return false
+		}
+	}
+
+	if rule.bodyMatches != nil {
+		body, err := bodyString(message.GetBody())
+		if err != nil || !rule.bodyMatches.MatchString(body) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Router) count(name string) {
+	r.countersMutex.Lock()
+	r.counters[name]++
+	r.countersMutex.Unlock()
+}
+
+// GetCounters returns number of jobs passed to every route
+func (r *Router) GetCounters() map[string]int64 {
+	r.countersMutex.Lock()
+	defer r.countersMutex.Unlock()
+	counters := make(map[string]int64, len(r.counters))
+	for name, value := range r.counters {
+		counters[name] = value
+	}
+	return counters
+}
+
+// Link - resolve route processors
+func (r *Router) Link(context *qp.Context) error {
+	resolve := func(name string) (qp.IProcessor, error) {
+		processor, ok := context.AvailableProcessors[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown processor [%s] requested for Router route", name)
+		}
+		if *processor == qp.IProcessor(r) {
+			return nil, errors.New("Router can not route to itself")
+		}
+		return *processor, nil
+	}
+
+	for i := range r.rules {
+		processor, err := resolve(r.rules[i].configuration.Processor)
+		if err != nil {
+			return err
+		}
+		r.rules[i].processor = processor
+	}
+
+	if r.configuration.Default != "" {
+		processor, err := resolve(r.configuration.Default)
+		if err != nil {
+			return err
+		}
+		r.defaultRoute = processor
+	}
+
+	return nil
+}
+
+// Options returns options struct of the processor
+func (r *Router) Options() interface{} {
+	return &routerConfiguration{}
+}
+
+// Configure - configure processor
+func (r *Router) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &r.configuration); err != nil {
+		return err
+	}
+
+	if len(r.configuration.Rules) == 0 && r.configuration.Default == "" {
+		return errors.New("Router should have at least one rule or Default route")
+	}
+
+	r.rules = nil
+	for i, ruleConfiguration := range r.configuration.Rules {
+		if ruleConfiguration.Processor == "" {
+			return fmt.Errorf("Router rule #%d has no Processor", i+1)
+		}
+		if ruleConfiguration.Name == "" {
+			ruleConfiguration.Name = ruleConfiguration.Processor
+		}
+		if ruleConfiguration.Field != "" && ruleConfiguration.Attribute != "" {
+			return fmt.Errorf("Router rule %s should have either Field or Attribute, not both", ruleConfiguration.Name)
+		}
+		if ruleConfiguration.Field == "" && ruleConfiguration.Attribute == "" && ruleConfiguration.BodyMatches == "" {
+			return fmt.Errorf("Router rule %s should have Field, Attribute or BodyMatches condition", ruleConfiguration.Name)
+		}
+
+		rule := routerRule{configuration: ruleConfiguration}
+		var err error
+		if ruleConfiguration.Matches != "" {
+			if rule.matches, err = regexp.Compile(ruleConfiguration.Matches); err != nil {
+				return err
+			}
+		}
+		if ruleConfiguration.BodyMatches != "" {
+			if rule.bodyMatches, err = regexp.Compile(ruleConfiguration.BodyMatches); err != nil {
+				return err
+			}
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	r.counters = make(map[string]int64)
+
+	r.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "Router",
+	})
+
+	r.logger.WithField("configuration", r.configuration).Info("Configuration loaded")
+
+	return nil
+}
@@ -2,32 +2,50 @@ package processor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/iVariable/qp/src/qp"
 	"github.com/iVariable/qp/src/utils"
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
 )
 
 // Shell - run custom shell command for message processing
-// Acknowledge message in case exit code = 0
-// Any other code - reject
+// Acknowledge message in case exit code is one of AckExitCodes (0 by default)
+// Exit code from RetryExitCodes - job is retried by strategy
+// Exit code from RejectExitCodes - reject. If RejectExitCodes is set, any other code is an error: job is left
+// unresolved (message returns to the queue) and error is handled by OnProcessingError of the strategy.
+// Otherwise any other code - reject
 type Shell struct {
 	configuration shellConfiguration
+	env           map[string]*template.Template
 	logger        *log.Entry
 }
 
 type shellConfiguration struct {
-	Command            string
-	MessagePlaceholder string
+	Command            string `required:"true"`
+	MessagePlaceholder string `default:"%msg%"`
 	EchoOutput         bool
 	SendRaw            bool
+	Stdin              bool
+	Env                map[string]string
+	WorkingDir         string
+	Timeout            int
+	AckExitCodes       []int `default:"0"`
+	RejectExitCodes    []int
+	RetryExitCodes     []int
 }
 
 // Process - Process job
-func (l *Shell) Process(job qp.IJob) error {
-	l.logger.WithField("job", job).Debug("Processing job")
+func (l *Shell) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, l.logger)
+	logger.WithField("job", job).Debug("Processing job")
 	var msg string
 	var err error
 	if l.configuration.SendRaw {
@@ -35,49 +53,256 @@ func (l *Shell) Process(job qp.IJob) error {
 	} else {
 		msg, err = job.GetMessage().Serialize()
 		if err != nil {
-			l.logger.WithField("error", err).Error("Error during message serialization")
+			logger.WithField("error", err).Error("Error during message serialization")
 			return err
 		}
 	}
 
+	_, exitCode, timedOut, reason, err := l.execute(ctx, msg, job.GetMessage())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !timedOut && containsCode(l.configuration.AckExitCodes, exitCode):
+		if ackError := job.AckMessage(); ackError != nil {
+			logger.WithField("error", ackError).Debug("Error on MessageAcknowledge")
+			return ackError
+		}
+		logger.Debug("job acknowledged")
+		return nil
+	case !timedOut && containsCode(l.configuration.RetryExitCodes, exitCode):
+		logger.WithField("exitCode", exitCode).Debug("job retry requested")
+		return qp.NewRetryError(errors.New(reason), 0)
+	case l.isUnexpectedCode(exitCode, timedOut):
+		logger.WithField("exitCode", exitCode).Debug("job left unresolved")
+		return unexpectedCodeError(exitCode, reason)
+	}
+
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+	if jError := job.RejectMessage(); jError != nil {
+		logger.WithField("error", jError).Debug("Error on MessageReject")
+		return jError
+	}
+	logger.WithFields(log.Fields{
+		"exitCode": exitCode,
+		"reason":   reason,
+	}).Debug("job rejected")
+	return nil //Normal finish of the operation, not an error
+}
+
+// ProcessBatch - Process batch of jobs. Command receives JSON array of message bodies (via placeholder or stdin).
+// On ack exit code stdout may hold JSON array of per-item results, otherwise all jobs are acknowledged.
+// Retry exit code - batch is retried, reject exit code - all jobs are rejected. Other codes are handled as for one job
+func (l *Shell) ProcessBatch(ctx context.Context, jobs []qp.IJob) error {
+	logger := qp.JobLogger(ctx, l.logger)
+	logger.WithField("jobs", len(jobs)).Debug("Processing batch")
+	msg, err := batchBody(jobs)
+	if err != nil {
+		logger.WithField("error", err).Error("Error during batch serialization")
+		return err
+	}
+
+	// Env is static in batch mode (see CheckBatchSupport), it is the same for every message
+	output, exitCode, timedOut, reason, err := l.execute(ctx, string(msg), jobs[0].GetMessage())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !timedOut && containsCode(l.configuration.AckExitCodes, exitCode):
+		if results, ok := parseBatchResults(output, len(jobs)); ok {
+			return resolveBatch(jobs, results, logger)
+		}
+		return resolveBatchWith(jobs, BatchVerdictAck, "", logger)
+	case !timedOut && containsCode(l.configuration.RetryExitCodes, exitCode):
+		logger.WithField("exitCode", exitCode).Debug("batch retry requested")
+		return resolveBatchWith(jobs, BatchVerdictRetry, reason, logger)
+	case l.isUnexpectedCode(exitCode, timedOut):
+		logger.WithField("exitCode", exitCode).Debug("batch left unresolved")
+		return unexpectedCodeError(exitCode, reason)
+	}
+
+	logger.WithFields(log.Fields{
+		"exitCode": exitCode,
+		"reason":   reason,
+	}).Debug("batch rejected")
+	return resolveBatchWith(jobs, BatchVerdictReject, reason, logger)
+}
+
+// CheckBatchSupport - Env templates are rendered per message, only static Env is allowed in batch mode
+func (l *Shell) CheckBatchSupport() error {
+	for name, t := range l.env {
+		if !isStaticTemplate(t) {
+			return fmt.Errorf("Env %s is a template, only static Env values are supported in batch mode", name)
+		}
+	}
+	return nil
+}
+
+// execute runs command for serialized message (or batch), returns its output, exit code and failure reason.
+// Env templates are rendered with the given message. Cancelled ctx kills the command and is returned as error
+func (l *Shell) execute(ctx context.Context, msg string, message qp.IMessage) (output []byte, exitCode int, timedOut bool, reason string, err error) {
+	logger := qp.JobLogger(ctx, l.logger)
 	commandLine := strings.Replace(l.configuration.Command, l.configuration.MessagePlaceholder, msg, -1) //TODO message escaping missing!
 
 	cmd := exec.Command("bash", "-c", commandLine) //TODO lol
+	cmd.Dir = l.configuration.WorkingDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	l.logger.WithField("command", cmd.Args).Debug("Command to execute")
+	if cmd.Env, err = l.buildEnv(message); err != nil {
+		logger.WithField("error", err).Error("Error during environment rendering")
+		return nil, 0, false, "", err
+	}
+	if correlationID := qp.CorrelationID(ctx); correlationID != "" {
+		cmd.Env = append(cmd.Env, CorrelationIDEnv+"="+correlationID)
+	}
+	for name, value := range qp.TraceContextFields(ctx) {
+		cmd.Env = append(cmd.Env, strings.ToUpper(name)+"="+value)
+	}
 
-	var out bytes.Buffer
+	if l.configuration.Stdin {
+		cmd.Stdin = strings.NewReader(msg)
+	}
+
+	logger.WithField("command", cmd.Args).Debug("Command to execute")
+
+	var out, stderr bytes.Buffer
 	cmd.Stdout = &out
-	err = cmd.Run()
+	cmd.Stderr = &stderr
+
+	timedOut, err = l.run(ctx, cmd)
+	if ctx.Err() != nil {
+		return nil, 0, false, "", ctx.Err()
+	}
 
 	if l.configuration.EchoOutput {
 		fmt.Println(out.String())
 	}
 
+	exitCode = 0
 	if err != nil {
-		if jError := job.RejectMessage(); jError != nil {
-			l.logger.WithField("error", jError).Debug("Error on MessageReject")
-			return jError
+		exitCode = -1
+		if exitError, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Exited() {
+				exitCode = status.ExitStatus()
+			}
 		}
-		l.logger.Debug("job rejected")
-		return nil //Normal finish of the operation, not an error
 	}
-	if ackError := job.AckMessage(); ackError != nil {
-		l.logger.WithField("error", ackError).Debug("Error on MessageAcknowledge")
-		return ackError
+
+	switch {
+	case timedOut:
+		reason = fmt.Sprintf("Command timed out after %d seconds", l.configuration.Timeout)
+	case err != nil:
+		reason = fmt.Sprintf("Command failed: %s", err.Error())
+	}
+	if stderr.Len() > 0 {
+		reason = strings.TrimSpace(reason + "\n" + stderr.String())
 	}
 
-	l.logger.Debug("job acknowledged")
+	return out.Bytes(), exitCode, timedOut, reason, nil
+}
 
-	return nil
+// run runs command and kills its whole process group on timeout or ctx cancellation
+func (l *Shell) run(ctx context.Context, cmd *exec.Cmd) (timedOut bool, err error) {
+	logger := qp.JobLogger(ctx, l.logger)
+	if err = cmd.Start(); err != nil {
+		return false, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if l.configuration.Timeout > 0 {
+		timer := time.NewTimer(time.Duration(l.configuration.Timeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err = <-done:
+		return false, err
+	case <-timeout:
+		logger.WithField("pid", cmd.Process.Pid).Warn("Command timed out. Killing process group")
+		l.kill(cmd)
+		return true, <-done
+	case <-ctx.Done():
+		logger.WithFields(log.Fields{
+			"pid":    cmd.Process.Pid,
+			"reason": ctx.Err(),
+		}).Info("Job cancelled. Killing process group")
+		l.kill(cmd)
+		return false, <-done
+	}
+}
+
+// kill kills whole process group of the command
+func (l *Shell) kill(cmd *exec.Cmd) {
+	if killError := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); killError != nil {
+		l.logger.WithField("error", killError).Error("Error on process group kill")
+	}
+}
+
+// buildEnv returns environment for the command: inherited one plus rendered Env option
+func (l *Shell) buildEnv(message qp.IMessage) ([]string, error) {
+	env := os.Environ()
+	if len(l.env) == 0 {
+		return env, nil
+	}
+
+	data := newMessageTemplateData(message)
+	for name, t := range l.env {
+		value, err := renderTemplate(t, data)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
+
+// Options returns options struct of the processor
+func (l *Shell) Options() interface{} {
+	return &shellConfiguration{}
 }
 
 // Configure - configure processor
 func (l *Shell) Configure(configuration map[string]interface{}) error {
-	utils.FillStruct(configuration, &l.configuration)
+	if err := utils.Decode(configuration, &l.configuration); err != nil {
+		return err
+	}
 	if l.configuration.MessagePlaceholder == "" {
 		l.configuration.MessagePlaceholder = "%msg%"
 	}
+	if l.configuration.Timeout < 0 {
+		return errors.New("Timeout setting for Shell should be >= 0")
+	}
+	if len(l.configuration.AckExitCodes) == 0 {
+		return errors.New("AckExitCodes setting for Shell should not be empty")
+	}
+
+	for _, code := range l.configuration.RetryExitCodes {
+		if containsCode(l.configuration.AckExitCodes, code) || containsCode(l.configuration.RejectExitCodes, code) {
+			return fmt.Errorf("Exit code %d is configured for several outcomes", code)
+		}
+	}
+	for _, code := range l.configuration.RejectExitCodes {
+		if containsCode(l.configuration.AckExitCodes, code) {
+			return fmt.Errorf("Exit code %d is configured for several outcomes", code)
+		}
+	}
+
+	env, err := parseTemplates("Env", l.configuration.Env)
+	if err != nil {
+		return err
+	}
+	l.env = env
+
 	l.logger = log.WithFields(log.Fields{
 		"type":      "processor",
 		"processor": "Shell",
@@ -85,3 +310,22 @@ func (l *Shell) Configure(configuration map[string]interface{}) error {
 	l.logger.WithField("configuration", l.configuration).Info("Configuration loaded")
 	return nil
 }
+
+// isUnexpectedCode returns true for exit code which is not listed in any exit codes setting while RejectExitCodes is set.
+// Timed out command is always rejected
+func (l *Shell) isUnexpectedCode(exitCode int, timedOut bool) bool {
+	return !timedOut && len(l.configuration.RejectExitCodes) > 0 && !containsCode(l.configuration.RejectExitCodes, exitCode)
+}
+
+func unexpectedCodeError(exitCode int, reason string) error {
+	return fmt.Errorf("Command exited with unexpected code %d: %s", exitCode, reason)
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,411 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ShellWorker verdict constants
+const (
+	ShellWorkerVerdictAck    = "ack"
+	ShellWorkerVerdictReject = "reject"
+	ShellWorkerVerdictRetry  = "retry"
+)
+
+// ShellWorker - keeps pool of long-living child processes and sends jobs to them
+// as newline-delimited JSON over stdin. Child answers with JSON verdict line on stdout.
+// Child is restarted after crash, after timeout and after MaxJobs processed jobs
+type ShellWorker struct {
+	configuration shellWorkerConfiguration
+	slots         chan bool // limits number of children when Processes is set
+	idle          []*shellWorkerChild
+	started       int
+	closed        bool
+	mutex         sync.Mutex
+	requestID     int64
+	logger        *log.Entry
+}
+
+type shellWorkerConfiguration struct {
+	Command    string `required:"true"`
+	Processes  int
+	MaxJobs    int
+	Timeout    int
+	WorkingDir string
+	Env        map[string]string
+	SendRaw    bool
+}
+
+type shellWorkerChild struct {
+	id     int
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	jobs   int
+	logger *log.Entry
+}
+
+type shellWorkerRequest struct {
+	ID            int64              `json:"id"`
+	Message       shellWorkerMessage `json:"message"`
+	CorrelationID string             `json:"correlationId,omitempty"`
+	TraceContext  map[string]string  `json:"traceContext,omitempty"`
+}
+
+type shellWorkerMessage struct {
+	ID         interface{}       `json:"id"`
+	Body       interface{}       `json:"body"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type shellWorkerResponse struct {
+	ID         int64  `json:"id"`
+	Verdict    string `json:"verdict"`
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retryAfter"`
+}
+
+type shellWorkerReadResult struct {
+	line []byte
+	err  error
+}
+
+// Process - Process job
+func (w *ShellWorker) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, w.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	request := shellWorkerRequest{
+		ID: atomic.AddInt64(&w.requestID, 1),
+		Message: shellWorkerMessage{
+			ID:         job.GetMessage().GetID(),
+			Body:       job.GetMessage().GetBody(),
+			Attributes: job.GetMessage().GetAttributes(),
+		},
+		CorrelationID: qp.CorrelationID(ctx),
+		TraceContext:  qp.TraceContextFields(ctx),
+	}
+	if w.configuration.SendRaw {
+		request.Message.Body = job.GetMessage().GetRaw()
+	}
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		logger.WithField("error", err).Error("Error during message serialization")
+		return err
+	}
+
+	child, err := w.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer w.release(child)
+
+	response, err := child.exchange(ctx, append(line, '\n'), time.Duration(w.configuration.Timeout)*time.Second, w.configuration)
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+	if err == errShellWorkerTimeout {
+		return w.reject(job, fmt.Sprintf("Worker timed out after %d seconds", w.configuration.Timeout))
+	}
+	if err != nil {
+		child.logger.WithField("error", err).Warn("Worker failed. It will be restarted")
+		child.kill()
+		return qp.NewRetryError(err, 0)
+	}
+
+	if response.ID != request.ID {
+		child.logger.WithFields(log.Fields{
+			"expected": request.ID,
+			"received": response.ID,
+		}).Warn("Worker answered for wrong request. It will be restarted")
+		child.kill()
+		return qp.NewRetryError(errors.New("Worker answered for wrong request"), 0)
+	}
+
+	if w.configuration.MaxJobs > 0 && child.jobs >= w.configuration.MaxJobs {
+		child.logger.WithField("jobs", child.jobs).Info("Worker reached MaxJobs. It will be restarted")
+		child.shutdown()
+	}
+
+	switch response.Verdict {
+	case ShellWorkerVerdictAck:
+		if ackError := job.AckMessage(); ackError != nil {
+			logger.WithField("error", ackError).Debug("Error on MessageAcknowledge")
+			return ackError
+		}
+		logger.Debug("job acknowledged")
+		return nil
+	case ShellWorkerVerdictRetry:
+		logger.Debug("job retry requested")
+		return qp.NewRetryError(errors.New(response.Reason), time.Duration(response.RetryAfter)*time.Second)
+	case ShellWorkerVerdictReject:
+		return w.reject(job, response.Reason)
+	default:
+		return w.reject(job, fmt.Sprintf("Unknown verdict [%s] received from worker", response.Verdict))
+	}
+}
+
+func (w *ShellWorker) reject(job qp.IJob, reason string) error {
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+	if jError := job.RejectMessage(); jError != nil {
+		w.logger.WithField("error", jError).Debug("Error on MessageReject")
+		return jError
+	}
+	w.logger.WithField("reason", reason).Debug("job rejected")
+	return nil //Normal finish of the operation, not an error
+}
+
+// acquire takes idle child from the pool or creates new one. Without Processes limit pool grows up to
+// the number of jobs processed at once, i.e. one child per worker of the strategy
+func (w *ShellWorker) acquire(ctx context.Context) (*shellWorkerChild, error) {
+	if w.slots != nil {
+		select {
+		case <-w.slots:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if last := len(w.idle) - 1; last >= 0 {
+		child := w.idle[last]
+		w.idle = w.idle[:last]
+		return child, nil
+	}
+
+	w.started++
+	return &shellWorkerChild{
+		id:     w.started,
+		logger: w.logger.WithField("worker", w.started),
+	}, nil
+}
+
+// release returns child to the pool. Child is stopped if processor was closed while it was busy
+func (w *ShellWorker) release(child *shellWorkerChild) {
+	w.mutex.Lock()
+	if w.closed {
+		child.shutdown()
+	}
+	w.idle = append(w.idle, child)
+	w.mutex.Unlock()
+
+	if w.slots != nil {
+		w.slots <- true
+	}
+}
+
+var errShellWorkerTimeout = errors.New("Worker timed out")
+
+// exchange sends request line to the child (starting it if needed) and reads response line.
+// Child is killed on timeout or ctx cancellation, also when it does not read its stdin
+func (c *shellWorkerChild) exchange(ctx context.Context, line []byte, timeout time.Duration, configuration shellWorkerConfiguration) (*shellWorkerResponse, error) {
+	logger := qp.JobLogger(ctx, c.logger)
+	if c.cmd == nil {
+		if err := c.start(configuration); err != nil {
+			return nil, err
+		}
+	}
+
+	c.jobs++
+
+	// pipes of the current process are captured: child may be restarted while the exchange of the killed one
+	// is still unblocking. Write and read are both bounded by timeout and ctx, killed process unblocks them
+	stdin, stdout := c.stdin, c.stdout
+	results := make(chan shellWorkerReadResult, 1)
+	go func() {
+		if _, err := stdin.Write(line); err != nil {
+			results <- shellWorkerReadResult{nil, err}
+			return
+		}
+		line, err := stdout.ReadBytes('\n')
+		results <- shellWorkerReadResult{line, err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var result shellWorkerReadResult
+	select {
+	case result = <-results:
+	case <-expired:
+		logger.Warn("Worker timed out. Killing process group")
+		c.kill()
+		return nil, errShellWorkerTimeout
+	case <-ctx.Done():
+		logger.WithField("reason", ctx.Err()).Info("Job cancelled. Killing process group")
+		c.kill()
+		return nil, ctx.Err()
+	}
+
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	var response shellWorkerResponse
+	if err := json.Unmarshal(result.line, &response); err != nil {
+		return nil, fmt.Errorf("Malformed worker response: %s", err.Error())
+	}
+
+	return &response, nil
+}
+
+func (c *shellWorkerChild) start(configuration shellWorkerConfiguration) error {
+	cmd := exec.Command("bash", "-c", configuration.Command)
+	cmd.Dir = configuration.WorkingDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = os.Environ()
+	for name, value := range configuration.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	cmd.Stderr = &logWriter{logger: c.logger}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	c.cmd = cmd
+	c.stdin = stdin
+	c.stdout = bufio.NewReader(stdout)
+	c.jobs = 0
+	c.logger.WithField("pid", cmd.Process.Pid).Info("Worker started")
+
+	return nil
+}
+
+// shutdown closes stdin of the child letting it finish, kills it if it does not in time
+func (c *shellWorkerChild) shutdown() {
+	if c.cmd == nil {
+		return
+	}
+	cmd := c.cmd
+	c.stdin.Close()
+	c.cmd = nil
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+	}
+	c.logger.WithField("pid", cmd.Process.Pid).Info("Worker stopped")
+}
+
+// kill kills the whole process group of the child
+func (c *shellWorkerChild) kill() {
+	if c.cmd == nil {
+		return
+	}
+	cmd := c.cmd
+	c.cmd = nil
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		c.logger.WithField("error", err).Debug("Error on process group kill")
+	}
+	c.stdin.Close()
+	cmd.Wait()
+	c.logger.WithField("pid", cmd.Process.Pid).Info("Worker killed")
+}
+
+// Close stops idle child processes, busy ones are stopped when their jobs finish
+func (w *ShellWorker) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = true
+	for _, child := range w.idle {
+		child.shutdown()
+	}
+	return nil
+}
+
+// Options returns options struct of the processor
+func (w *ShellWorker) Options() interface{} {
+	return &shellWorkerConfiguration{}
+}
+
+// Configure - configure processor
+func (w *ShellWorker) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &w.configuration); err != nil {
+		return err
+	}
+
+	if w.configuration.Command == "" {
+		return errors.New("Command setting for ShellWorker should not be empty")
+	}
+	if w.configuration.Processes < 0 {
+		return errors.New("Processes setting for ShellWorker should be >= 0")
+	}
+	if w.configuration.MaxJobs < 0 || w.configuration.Timeout < 0 {
+		return errors.New("MaxJobs and Timeout settings for ShellWorker should be >= 0")
+	}
+
+	w.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "ShellWorker",
+	})
+
+	if w.configuration.Processes > 0 {
+		w.slots = make(chan bool, w.configuration.Processes)
+		for i := 0; i < w.configuration.Processes; i++ {
+			w.slots <- true
+		}
+	}
+
+	w.logger.WithField("configuration", w.configuration).Info("Configuration loaded")
+	return nil
+}
+
+// logWriter - io.Writer which logs every written line
+type logWriter struct {
+	logger *log.Entry
+	buffer string
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.buffer += string(p)
+	for {
+		i := strings.IndexByte(l.buffer, '\n')
+		if i < 0 {
+			break
+		}
+		l.logger.WithField("stream", "stderr").Info(l.buffer[:i])
+		l.buffer = l.buffer[i+1:]
+	}
+	return len(p), nil
+}
@@ -1,6 +1,7 @@
 package processor
 
 import (
+	"context"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/iVariable/qp/src/qp"
@@ -13,14 +14,15 @@ type Stdout struct {
 }
 
 // Process - process job
-func (l *Stdout) Process(job qp.IJob) error {
-	l.logger.WithField("job", job).Debug("Processing job")
+func (l *Stdout) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, l.logger)
+	logger.WithField("job", job).Debug("Processing job")
 	fmt.Printf("[Stdout processor] Received message: %#v\n", job.GetMessage())
 	if ackError := job.AckMessage(); ackError != nil {
-		l.logger.WithField("error", ackError).Debug("Error on message acknowledge")
+		logger.WithField("error", ackError).Debug("Error on message acknowledge")
 		return ackError
 	}
-	l.logger.Debug("Message acknowledged")
+	logger.Debug("Message acknowledged")
 	return nil
 }
 
@@ -0,0 +1,298 @@
+package processor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"strings"
+	"text/template"
+)
+
+// Transform step type constants
+const (
+	TransformStepUnwrapSNS    = "UnwrapSNS"
+	TransformStepBase64Decode = "Base64Decode"
+	TransformStepExtract      = "Extract"
+	TransformStepRename       = "Rename"
+	TransformStepTemplate     = "Template"
+	TransformStepSetAttribute = "SetAttribute"
+)
+
+// Transform - rewrites message body and attributes with the list of steps.
+// Inside of Pipeline rewritten message is passed to the following stages and the stage is acknowledged.
+// With Processor option set, job with rewritten message is passed to that processor (inline usage).
+// Message which can not be transformed is rejected
+type Transform struct {
+	configuration transformConfiguration
+	steps         []transformStep
+	processor     qp.IProcessor
+	logger        *log.Entry
+}
+
+type transformConfiguration struct {
+	Steps     []transformStepConfiguration
+	Processor string `ref:"processor"`
+}
+
+type transformStepConfiguration struct {
+	Type     string
+	Path     string
+	From     string
+	To       string
+	Name     string
+	Template string
+}
+
+type transformStep struct {
+	configuration transformStepConfiguration
+	template      *template.Template
+}
+
+// Process - Process job
+func (t *Transform) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, t.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	message, err := t.transform(job.GetMessage())
+	if err != nil {
+		reason := "Transformation failed: " + err.Error()
+		if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+			failureAware.SetFailureReason(reason)
+		}
+		if rejectError := job.RejectMessage(); rejectError != nil {
+			logger.WithError(rejectError).Debug("Error on MessageReject")
+			return rejectError
+		}
+		logger.WithField("reason", reason).Debug("Job rejected")
+		return nil
+	}
+
+	if t.processor != nil {
+		return t.processor.Process(ctx, qp.NewRewrittenJob(job, message))
+	}
+
+	mutable, ok := job.(qp.IMutableJob)
+	if !ok {
+		return errors.New("Transform without Processor option can be used only as Pipeline stage")
+	}
+	mutable.SetMessage(message)
+
+	if ackError := job.AckMessage(); ackError != nil {
+		logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+		return ackError
+	}
+	logger.Debug("Job transformed")
+	return nil
+}
+
+// transform applies all steps to the copy of the message. Steps work on body as string, bodies decoded by codecs
+// (maps, lists, etc) are encoded as JSON first
+func (t *Transform) transform(original qp.IMessage) (qp.IMessage, error) {
+	message := &qp.Message{
+		ID:         original.GetID(),
+		Body:       original.GetBody(),
+		Raw:        original.GetRaw(),
+		Attributes: make(map[string]string),
+	}
+	for name, value := range original.GetAttributes() {
+		message.Attributes[name] = value
+	}
+
+	for _, step := range t.steps {
+		var err error
+		if step.configuration.Type == TransformStepSetAttribute {
+			// attribute is set, body and raw body are left untouched
+			if message.Attributes[step.configuration.Name], err = renderTemplate(step.template, newMessageTemplateData(message)); err != nil {
+				return nil, fmt.Errorf("%s step: %s", step.configuration.Type, err.Error())
+			}
+			continue
+		}
+
+		body, err := bodyString(message.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s step: %s", step.configuration.Type, err.Error())
+		}
+
+		switch step.configuration.Type {
+		case TransformStepUnwrapSNS:
+			body, err = unwrapSNS(body, message.Attributes)
+		case TransformStepBase64Decode:
+			var decoded []byte
+			decoded, err = base64.StdEncoding.DecodeString(strings.TrimSpace(body))
+			body = string(decoded)
+		case TransformStepExtract:
+			body, err = extractPath(body, step.configuration.Path)
+		case TransformStepRename:
+			body, err = renameKey(body, step.configuration.From, step.configuration.To)
+		case TransformStepTemplate:
+			body, err = renderTemplate(step.template, newMessageTemplateData(message))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s step: %s", step.configuration.Type, err.Error())
+		}
+
+		message.Body = body
+		message.Raw = body
+	}
+
+	return message, nil
+}
+
+// unwrapSNS replaces SNS notification envelope with the notification message, SNS message attributes are merged into attributes
+func unwrapSNS(body string, attributes map[string]string) (string, error) {
+	var envelope struct {
+		Type              string
+		Message           *string
+		MessageAttributes map[string]struct {
+			Type  string
+			Value string
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return "", err
+	}
+	if envelope.Message == nil {
+		return "", errors.New("Body is not SNS notification")
+	}
+	for name, attribute := range envelope.MessageAttributes {
+		attributes[name] = attribute.Value
+	}
+	return *envelope.Message, nil
+}
+
+// extractPath replaces body with the value of dot-separated path. Non-string values are JSON encoded
+func extractPath(body string, path string) (string, error) {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		return "", err
+	}
+	value, ok := lookupPath(parsed, path)
+	if !ok {
+		return "", fmt.Errorf("Path %s not found", path)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+// renameKey moves value of dot-separated path From to dot-separated path To
+func renameKey(body string, from string, to string) (string, error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		return "", err
+	}
+
+	fromParent, fromKey, ok := parentObject(parsed, from, false)
+	if !ok {
+		return "", fmt.Errorf("Path %s not found", from)
+	}
+	value, ok := fromParent[fromKey]
+	if !ok {
+		return "", fmt.Errorf("Path %s not found", from)
+	}
+	toParent, toKey, ok := parentObject(parsed, to, true)
+	if !ok {
+		return "", fmt.Errorf("Path %s can not be created", to)
+	}
+
+	delete(fromParent, fromKey)
+	toParent[toKey] = value
+
+	encoded, err := json.Marshal(parsed)
+	return string(encoded), err
+}
+
+// parentObject returns object holding the last key of dot-separated path, optionally creating missing objects
+func parentObject(root map[string]interface{}, path string, create bool) (map[string]interface{}, string, bool) {
+	names := strings.Split(path, ".")
+	current := root
+	for _, name := range names[:len(names)-1] {
+		next, ok := current[name].(map[string]interface{})
+		if !ok {
+			if !create || current[name] != nil {
+				return nil, "", false
+			}
+			next = make(map[string]interface{})
+			current[name] = next
+		}
+		current = next
+	}
+	return current, names[len(names)-1], true
+}
+
+// Link - resolve inline processor
+func (t *Transform) Link(context *qp.Context) error {
+	if t.configuration.Processor == "" {
+		return nil
+	}
+	processor, ok := context.AvailableProcessors[t.configuration.Processor]
+	if !ok {
+		return fmt.Errorf("Unknown processor [%s] requested for Transform", t.configuration.Processor)
+	}
+	if *processor == qp.IProcessor(t) {
+		return errors.New("Transform can not pass jobs to itself")
+	}
+	t.processor = *processor
+	return nil
+}
+
+// Options returns options struct of the processor
+func (t *Transform) Options() interface{} {
+	return &transformConfiguration{}
+}
+
+// Configure - configure processor
+func (t *Transform) Configure(configuration map[string]interface{}) error {
+	if err := utils.Decode(configuration, &t.configuration); err != nil {
+		return err
+	}
+
+	if len(t.configuration.Steps) == 0 {
+		return errors.New("Transform should have at least one step")
+	}
+
+	t.steps = nil
+	for i, stepConfiguration := range t.configuration.Steps {
+		step := transformStep{configuration: stepConfiguration}
+		switch stepConfiguration.Type {
+		case TransformStepUnwrapSNS, TransformStepBase64Decode:
+		case TransformStepExtract:
+			if stepConfiguration.Path == "" {
+				return fmt.Errorf("Transform step #%d: Path should not be empty", i+1)
+			}
+		case TransformStepRename:
+			if stepConfiguration.From == "" || stepConfiguration.To == "" {
+				return fmt.Errorf("Transform step #%d: From and To should not be empty", i+1)
+			}
+		case TransformStepSetAttribute:
+			if stepConfiguration.Name == "" {
+				return fmt.Errorf("Transform step #%d: Name should not be empty", i+1)
+			}
+			fallthrough
+		case TransformStepTemplate:
+			var err error
+			if step.template, err = parseTemplate(fmt.Sprintf("Steps.%d", i+1), stepConfiguration.Template); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unknown Transform step type [%s]", stepConfiguration.Type)
+		}
+		t.steps = append(t.steps, step)
+	}
+
+	t.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "Transform",
+	})
+
+	t.logger.WithField("configuration", t.configuration).Info("Configuration loaded")
+
+	return nil
+}
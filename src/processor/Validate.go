@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/validation"
+)
+
+// validateConfiguration - options of Validate processor, Processor option is not passed to validator
+type validateConfiguration struct {
+	validation.Configuration
+	Processor string `ref:"processor"`
+}
+
+// Validate - validates message body against JSON Schema.
+// Invalid message is rejected (or dead-lettered) with validation errors as failure reason.
+// Valid message is passed to Processor (inline usage) or acknowledged (Pipeline stage usage).
+// Dead-lettered message ends the Pipeline
+type Validate struct {
+	processorName string
+	validator     validation.Validator
+	processor     qp.IProcessor
+	logger        *log.Entry
+}
+
+// Process - Process job
+func (v *Validate) Process(ctx context.Context, job qp.IJob) error {
+	logger := qp.JobLogger(ctx, v.logger)
+	logger.WithField("job", job).Debug("Processing job")
+
+	if errs := v.validator.Validate(job.GetMessage()); len(errs) > 0 {
+		return v.validator.HandleInvalid(ctx, job, errs)
+	}
+
+	if v.processor != nil {
+		return v.processor.Process(ctx, job)
+	}
+
+	if ackError := job.AckMessage(); ackError != nil {
+		logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+		return ackError
+	}
+	logger.Debug("Job is valid")
+	return nil
+}
+
+// Link - resolve inline processor and dead-letter queue
+func (v *Validate) Link(context *qp.Context) error {
+	if err := v.validator.Link(context); err != nil {
+		return err
+	}
+	if v.processorName == "" {
+		return nil
+	}
+	processor, ok := context.AvailableProcessors[v.processorName]
+	if !ok {
+		return fmt.Errorf("Unknown processor [%s] requested for Validate", v.processorName)
+	}
+	if *processor == qp.IProcessor(v) {
+		return errors.New("Validate can not pass jobs to itself")
+	}
+	v.processor = *processor
+	return nil
+}
+
+// Options returns options struct of the processor
+func (v *Validate) Options() interface{} {
+	return &validateConfiguration{}
+}
+
+// Configure - configure processor
+func (v *Validate) Configure(configuration map[string]interface{}) error {
+	v.logger = log.WithFields(log.Fields{
+		"type":      "processor",
+		"processor": "Validate",
+	})
+
+	validatorConfiguration := make(map[string]interface{})
+	for name, value := range configuration {
+		if name == "Processor" {
+			v.processorName, _ = value.(string)
+			continue
+		}
+		validatorConfiguration[name] = value
+	}
+
+	if err := v.validator.Configure(validatorConfiguration, v.logger); err != nil {
+		return err
+	}
+
+	v.logger.WithField("configuration", configuration).Info("Configuration loaded")
+
+	return nil
+}
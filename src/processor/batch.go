@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"strings"
+	"time"
+)
+
+// Batch item verdict constants
+const (
+	BatchVerdictAck    = "ack"
+	BatchVerdictReject = "reject"
+	BatchVerdictRetry  = "retry"
+)
+
+// batchItemResult - per-item result of batch processing.
+// Processors answer with JSON array of results in the order of batch items, e.g.
+// [{"verdict":"ack"},{"verdict":"reject","reason":"invalid email"},{"verdict":"retry","retryAfter":10}]
+type batchItemResult struct {
+	Verdict    string `json:"verdict"`
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retryAfter"`
+}
+
+// batchBody returns JSON array of message bodies. Bodies which are valid JSON are embedded as is, others as strings
+func batchBody(jobs []qp.IJob) ([]byte, error) {
+	items := make([]json.RawMessage, len(jobs))
+	for i, job := range jobs {
+		var err error
+		switch body := job.GetMessage().GetBody().(type) {
+		case string:
+			if json.Valid([]byte(body)) {
+				items[i] = json.RawMessage(body)
+			} else {
+				items[i], err = json.Marshal(body)
+			}
+		case []byte:
+			if json.Valid(body) {
+				items[i] = json.RawMessage(body)
+			} else {
+				items[i], err = json.Marshal(string(body))
+			}
+		default:
+			items[i], err = json.Marshal(body)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(items)
+}
+
+// parseBatchResults parses per-item results. Returns false if output is not a results array of the batch size
+func parseBatchResults(output []byte, size int) ([]batchItemResult, bool) {
+	var results []batchItemResult
+	if err := json.Unmarshal(output, &results); err != nil || len(results) != size {
+		return nil, false
+	}
+	for _, result := range results {
+		if result.Verdict == "" {
+			return nil, false
+		}
+	}
+	return results, true
+}
+
+// resolveBatch acknowledges or rejects every job according to its result.
+// Returns qp.RetryError if some jobs asked for retry, they are left unresolved
+func resolveBatch(jobs []qp.IJob, results []batchItemResult, logger *log.Entry) error {
+	var retryAfter time.Duration
+	var retryReasons []string
+	for i, job := range jobs {
+		result := results[i]
+		switch result.Verdict {
+		case BatchVerdictAck:
+			if ackError := job.AckMessage(); ackError != nil {
+				logger.WithField("error", ackError).Debug("Error on MessageAcknowledge")
+				return ackError
+			}
+		case BatchVerdictRetry:
+			if after := time.Duration(result.RetryAfter) * time.Second; after > retryAfter {
+				retryAfter = after
+			}
+			retryReasons = append(retryReasons, fmt.Sprintf("#%d: %s", i+1, result.Reason))
+		case BatchVerdictReject:
+			if err := rejectBatchJob(job, result.Reason, logger); err != nil {
+				return err
+			}
+		default:
+			if err := rejectBatchJob(job, fmt.Sprintf("Unknown verdict [%s] received", result.Verdict), logger); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(retryReasons) > 0 {
+		logger.WithField("jobs", len(retryReasons)).Debug("Batch jobs retry requested")
+		return qp.NewRetryError(errors.New(strings.Join(retryReasons, "; ")), retryAfter)
+	}
+	logger.WithField("jobs", len(jobs)).Debug("Batch resolved")
+	return nil
+}
+
+// resolveBatchWith applies the same verdict to every job of the batch
+func resolveBatchWith(jobs []qp.IJob, verdict string, reason string, logger *log.Entry) error {
+	results := make([]batchItemResult, len(jobs))
+	for i := range results {
+		results[i] = batchItemResult{Verdict: verdict, Reason: reason}
+	}
+	return resolveBatch(jobs, results, logger)
+}
+
+func rejectBatchJob(job qp.IJob, reason string, logger *log.Entry) error {
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+	if rejectError := job.RejectMessage(); rejectError != nil {
+		logger.WithField("error", rejectError).Debug("Error on MessageReject")
+		return rejectError
+	}
+	return nil
+}
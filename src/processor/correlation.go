@@ -0,0 +1,9 @@
+package processor
+
+// Names correlation ID of the job (see qp.CorrelationID) is passed under to processing applications
+const (
+	// CorrelationIDHeader - HTTPProxy request header, GRPC metadata key and FastCGI HTTP_X_CORRELATION_ID param
+	CorrelationIDHeader = "X-Correlation-ID"
+	// CorrelationIDEnv - Shell environment variable
+	CorrelationIDEnv = "QP_CORRELATION_ID"
+)
@@ -0,0 +1,169 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/iVariable/qp/src/qp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// messageTemplateData - data available inside of processor option templates
+// e.g. "{{.ID}}", "{{.Attributes.type}}", "{{.Fields.user.email}}"
+type messageTemplateData struct {
+	ID         interface{}
+	Body       interface{}
+	Raw        string
+	Attributes map[string]string
+	Fields     map[string]interface{}
+}
+
+func newMessageTemplateData(message qp.IMessage) messageTemplateData {
+	data := messageTemplateData{
+		ID:         message.GetID(),
+		Body:       message.GetBody(),
+		Raw:        message.GetRaw(),
+		Attributes: message.GetAttributes(),
+	}
+
+	switch body := message.GetBody().(type) {
+	case map[string]interface{}:
+		data.Fields = body
+	case string:
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &fields); err == nil {
+			data.Fields = fields
+		}
+	}
+
+	return data
+}
+
+// templateFunctions - helper functions available inside of templates,
+// e.g. "{{path .Fields \"items.0.id\"}}", "{{.Body | b64dec | json}}", "{{path .Attributes \"type\" | default \"none\"}}"
+var templateFunctions = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"b64enc": func(value string) string {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	},
+	"b64dec": func(value string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		return string(decoded), err
+	},
+	// path renders missing path as empty string
+	"path": func(value interface{}, path string) interface{} {
+		if result, ok := lookupPath(value, path); ok && result != nil {
+			return result
+		}
+		return ""
+	},
+	// default returns fallback for empty (missing) value
+	"default": func(fallback interface{}, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// parseTemplate parses single template. Missing map keys (attributes, fields) are execution errors,
+// optional values are looked up with path function
+func parseTemplate(name string, source string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(templateFunctions).Parse(source)
+}
+
+// parseTemplates parses map of named templates
+func parseTemplates(prefix string, sources map[string]string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	for name, source := range sources {
+		t, err := parseTemplate(prefix+"."+name, source)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// isStaticTemplate returns true if template is plain text without actions
+func isStaticTemplate(t *template.Template) bool {
+	if t.Tree == nil || t.Tree.Root == nil {
+		return true
+	}
+	for _, node := range t.Tree.Root.Nodes {
+		if node.Type() != parse.NodeText {
+			return false
+		}
+	}
+	return true
+}
+
+// renderTemplate renders template against message data
+func renderTemplate(t *template.Template, data messageTemplateData) (string, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// lookupPath returns value of dot-separated path (e.g. "user.type" or "items.0.id") in parsed JSON or attributes
+func lookupPath(value interface{}, path string) (interface{}, bool) {
+	current := value
+	for _, name := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if current, ok = node[name]; !ok {
+				return nil, false
+			}
+		case map[string]string:
+			var ok bool
+			if current, ok = node[name]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupField returns string representation of the value of dot-separated path in parsed JSON body
+func lookupField(fields map[string]interface{}, path string) (string, bool) {
+	value, ok := lookupPath(fields, path)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// bodyString returns message body as string. Bodies decoded by codecs (maps, lists, etc) are encoded as JSON
+func bodyString(body interface{}) (string, error) {
+	switch value := body.(type) {
+	case string:
+		return value, nil
+	case []byte:
+		return string(value), nil
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -1,25 +1,19 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/iVariable/qp/src/qp"
-	"github.com/iVariable/qp/src/resources"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp"
 	"github.com/iVariable/qp/src/utils"
-	"io/ioutil"
 	"os"
-
-	"flag"
-	log "github.com/Sirupsen/logrus"
-	"gopkg.in/yaml.v2"
-)
-
-var (
-	logger *log.Entry
-	config qp.Config
+	"strings"
+	"time"
 )
 
-func init() {
-	logger = log.WithFields(log.Fields{
+func main() {
+	logger := log.WithFields(log.Fields{
 		"build": "<buildID>",
 	})
 
@@ -27,165 +21,172 @@ func init() {
 		infoVerbosity  = flag.Bool("v", false, "Overrides log level verbosity to INFO level (default verbosity level is WARN)")
 		debugVerbosity = flag.Bool("vv", false, "Overrides log level verbosity to DEBUG level")
 		showHelp       = flag.Bool("help", false, "Show this help message")
+		liveProbe      = flag.Bool("live", false, "Health command checks liveness (/healthz) instead of readiness (/readyz)")
+		statusFormat   = flag.String("format", qp.StatusFormatTable, "Output format of status command: table, json or top (table refreshed every interval)")
+		statusInterval = flag.Int("interval", 2, "Refresh interval of top status format in seconds")
+		assignments    []string
 	)
+	flag.Var((*listFlag)(&assignments), "set", "Overrides configuration value, e.g. --set queue[0].options.QueueName=orders (can be repeated)")
 
 	flag.Parse()
 
-	if flag.NArg() != 1 || *showHelp {
-		fmt.Fprintf(os.Stderr, "Usage of %s: %s [options] path_to_config\n\n", os.Args[0], os.Args[0])
+	validate := flag.NArg() == 2 && flag.Arg(0) == "validate"
+	health := flag.NArg() == 2 && flag.Arg(0) == "health"
+	status := flag.NArg() == 2 && flag.Arg(0) == "status"
+	schema := flag.NArg() == 1 && flag.Arg(0) == "schema"
+	if (flag.NArg() != 1 && !validate && !health && !status) || *showHelp {
+		fmt.Fprintf(os.Stderr, "Usage of %s: %s [options] path_to_config\n", os.Args[0], os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s validate path_to_config\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [-live] health path_to_config\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [-format table|json|top] [-interval seconds] status path_to_config\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s schema\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "ARGUMENTS\n")
-		fmt.Fprintf(os.Stderr, "  path_to_config\n\tpath to config file\n")
+		fmt.Fprintf(os.Stderr, "  path_to_config\n\tpath to config file (YAML, JSON or TOML, detected by .json and .toml extension)\n")
+		fmt.Fprintf(os.Stderr, "COMMANDS\n")
+		fmt.Fprintf(os.Stderr, "  validate\n\tcheck config file (options, component types and references) without connecting to anything\n")
+		fmt.Fprintf(os.Stderr, "  health\n\tcheck readiness of qp running with config file (general.health.address), exits with non-zero code if it is not ready\n")
+		fmt.Fprintf(os.Stderr, "  status\n\tshow throughput, error rate, in-flight jobs and queue depth of qp running with config file (general.controlSocket)\n")
+		fmt.Fprintf(os.Stderr, "  schema\n\tprint JSON Schema of config file\n")
 		fmt.Fprintf(os.Stderr, "OPTIONS\n")
 		flag.PrintDefaults()
 		utils.Quit(utils.ExitCodeOk)
 	}
 
-	configFile := flag.Arg(0)
-
-	source, err := ioutil.ReadFile(configFile)
-	if err != nil {
-		logger.WithError(err).Fatal("Can't read config file")
-		utils.Quitf(utils.ExitCodeRuntimeError, "Can't read config file: %s", err.Error())
-	}
-	err = yaml.Unmarshal(source, &config)
-	if err != nil {
-		logger.WithError(err).Fatal("Can't unmarshal config file")
-		utils.Quitf(utils.ExitCodeRuntimeError, "Can't unmarshal config file: %s", err.Error())
+	if schema {
+		output, err := json.MarshalIndent(qp.Schema(), "", "  ")
+		if err != nil {
+			utils.Quitf(utils.ExitCodeRuntimeError, "Can't build schema: %s", err.Error())
+		}
+		fmt.Println(string(output))
+		utils.Quit(utils.ExitCodeOk)
 	}
 
-	if *infoVerbosity {
-		config.General.Log.Level = "info"
+	overrides := []func(config *qp.Config) error{
+		func(config *qp.Config) error {
+			if *infoVerbosity {
+				config.General.Log.Level = "info"
+			}
+
+			if *debugVerbosity {
+				config.General.Log.Level = "debug"
+			}
+			return nil
+		},
 	}
-
-	if *debugVerbosity {
-		config.General.Log.Level = "debug"
+	for _, assignment := range assignments {
+		override, err := qp.Set(assignment)
+		if err != nil {
+			utils.Quitf(utils.ExitCodeMisconfiguration, "%s", err.Error())
+		}
+		overrides = append(overrides, override)
 	}
-}
-
-func main() {
-	context := qp.NewContext(&config)
-
-	load(context)
-
-	go func() {
-		context.SendRun()
-	}()
-
-	context.DispatchLoop(run, stop, status)
-}
-
-func status(context *qp.Context) {
-	fmt.Println(context.Strategy.GetStatistics())
-}
-
-func load(context *qp.Context) {
-
-	loadLogger(context)
-
-	logger.WithField("config", context.Configuration).Info("Loading main configuration")
-
-	loadQueues(context)
-	loadProcessors(context)
-	loadStrategies(context)
-
-	context.Strategy = *context.AvailableStrategies[context.Configuration.Strategy[0].Name]
 
-	context.Set("IsRunning", false)
-}
-
-func loadLogger(context *qp.Context) {
-	level, err := log.ParseLevel(context.Configuration.General.Log.Level)
-	if err != nil {
-		utils.Quitf(utils.ExitCodeMisconfiguration, "Wrong LogLevel [%s]", context.Configuration.General.Log.Level)
+	if validate {
+		config, err := qp.LoadConfig(flag.Arg(1), overrides...)
+		if err == nil {
+			err = qp.Validate(config)
+		}
+		if err != nil {
+			utils.Quitf(utils.ExitCodeMisconfiguration, "Configuration is invalid:\n%s", err.Error())
+		}
+		fmt.Println("Configuration is valid")
+		utils.Quit(utils.ExitCodeOk)
 	}
-	log.SetLevel(level)
-}
 
-func loadQueues(context *qp.Context) {
-	for _, config := range context.Configuration.Queue {
-		newQueue, ok := resources.AvailableQueues[config.Type]
-		if !ok {
-			logger.WithField("requestedType", config.Type).Fatal("Unknown queue type requested")
-			utils.Quitf(utils.ExitCodeMisconfiguration, "Unknown queue type requested: %s", config.Type)
+	if health {
+		config, err := qp.LoadConfig(flag.Arg(1), overrides...)
+		if err != nil {
+			utils.Quitf(utils.ExitCodeMisconfiguration, "Can't load config file: %s", err.Error())
+		}
+		response, healthy, err := qp.ProbeHealth(config, *liveProbe)
+		if err != nil {
+			utils.Quitf(utils.ExitCodeRuntimeError, "Health check failed: %s", err.Error())
 		}
-		newInstance := newQueue()
-		if err := newInstance.Configure(config.Options); err != nil {
-			logger.WithField("error", err).Fatal("Error configuring queue")
-			utils.Quitf(utils.ExitCodeMisconfiguration, "Error configuring queue: %s", err.Error())
+		fmt.Print(response)
+		if !healthy {
+			utils.Quit(utils.ExitCodeRuntimeError)
 		}
-		context.AvailableQueues[config.Name] = &newInstance
+		utils.Quit(utils.ExitCodeOk)
 	}
-}
 
-func loadProcessors(context *qp.Context) {
-	for _, config := range context.Configuration.Processor {
-		newValue, ok := resources.AvailableProcessors[config.Type]
-		if !ok {
-			logger.WithField("requestedType", config.Type).Fatal("Unknown processor type requested")
-			utils.Quitf(utils.ExitCodeMisconfiguration, "Unknown processor type requested: %s", config.Type)
+	if status {
+		config, err := qp.LoadConfig(flag.Arg(1), overrides...)
+		if err != nil {
+			utils.Quitf(utils.ExitCodeMisconfiguration, "Can't load config file: %s", err.Error())
 		}
-		newInstance := newValue()
-		if err := newInstance.Configure(config.Options); err != nil {
-			logger.WithField("error", err).Fatal("Error configuring processor")
-			utils.Quitf(utils.ExitCodeMisconfiguration, "Error configuring processor: %s", err.Error())
-		}
-		context.AvailableProcessors[config.Name] = &newInstance
+		showStatus(config, *statusFormat, time.Duration(*statusInterval)*time.Second)
+		utils.Quit(utils.ExitCodeOk)
 	}
-}
 
-func loadStrategies(context *qp.Context) {
-	if len(context.Configuration.Strategy) != 1 {
-		logger.Fatal("There should be exactly one Strategy configured")
-		utils.Quitf(utils.ExitCodeMisconfiguration, "There should be exactly one Strategy configured")
+	config, err := qp.LoadConfig(flag.Arg(0), overrides...)
+	if err != nil {
+		logger.WithError(err).Error("Can't load config file")
+		utils.Quitf(utils.ExitCodeRuntimeError, "Can't load config file: %s", err.Error())
 	}
-	for _, config := range context.Configuration.Strategy {
-		newValue, ok := resources.AvailableStrategies[config.Type]
-		if !ok {
-			logger.WithField("requestedType", config.Type).Fatal("Unknown strategy type requested")
-			utils.Quitf(utils.ExitCodeMisconfiguration, "Unknown strategy type requested: %s", config.Type)
-		}
-		newInstance := newValue()
-		if err := newInstance.Configure(config.Options, context); err != nil {
-			logger.WithField("error", err).Fatal("Error configuring strategy")
-			utils.Quitf(utils.ExitCodeMisconfiguration, "Error configuring strategy: %s", err.Error())
+
+	if *debugVerbosity {
+		if resolved, err := qp.DumpConfig(config); err == nil {
+			fmt.Fprintf(os.Stderr, "Resolved configuration:\n%s\n", resolved)
 		}
-		context.AvailableStrategies[config.Name] = &newInstance
 	}
-}
 
-func stop(context *qp.Context) {
-	context.Set("StrategyInitiatedStop", false)
-	if err := context.Strategy.Stop(); err != nil {
-		panic(err)
+	code, err := qp.Run(config)
+	if err != nil {
+		utils.Quitf(code, "%s", err.Error())
 	}
-	context.Set("IsRunning", false)
+	utils.Quit(code)
 }
 
-func run(context *qp.Context) {
-	context.Set("StrategyInitiatedStop", true)
-
-	logger.Info("Configuring processing strategy")
-	config := make(map[string]interface{})
-
-	for k, v := range context.Configuration.Strategy[0].Options {
-		config[k] = v
+// showStatus prints status of running qp in the format. Top format refreshes the table until interrupted
+func showStatus(config *qp.Config, format string, interval time.Duration) {
+	switch format {
+	case qp.StatusFormatTable:
+		status, err := qp.QueryStatus(config)
+		if err != nil {
+			utils.Quitf(utils.ExitCodeRuntimeError, "Can't get status: %s", err.Error())
+		}
+		qp.RenderStatus(os.Stdout, status, nil)
+	case qp.StatusFormatJSON:
+		status, err := qp.QueryStatus(config)
+		if err != nil {
+			utils.Quitf(utils.ExitCodeRuntimeError, "Can't get status: %s", err.Error())
+		}
+		output, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			utils.Quitf(utils.ExitCodeRuntimeError, "Can't get status: %s", err.Error())
+		}
+		fmt.Println(string(output))
+	case qp.StatusFormatTop:
+		if interval <= 0 {
+			utils.Quitf(utils.ExitCodeMisconfiguration, "Refresh interval should be > 0")
+		}
+		var previous *qp.Status
+		for {
+			status, err := qp.QueryStatus(config)
+			fmt.Print("\033[H\033[2J") // clear screen
+			fmt.Printf("qp status, refreshed every %s (Ctrl+C to exit)\n\n", interval)
+			if err != nil {
+				fmt.Printf("Can't get status: %s\n", err.Error())
+			} else {
+				qp.RenderStatus(os.Stdout, status, previous)
+			}
+			previous = status
+			time.Sleep(interval)
+		}
+	default:
+		utils.Quitf(utils.ExitCodeMisconfiguration, "Unknown status format %q, %s, %s or %s expected",
+			format, qp.StatusFormatTable, qp.StatusFormatJSON, qp.StatusFormatTop)
 	}
+}
 
-	config["Name"] = context.Configuration.Strategy[0].Name
+// listFlag - flag which can be repeated
+type listFlag []string
 
-	if err := context.Strategy.Configure(config, context); err != nil {
-		logger.WithField("error", err).Fatal("Error configuring strategy")
-		utils.Quitf(utils.ExitCodeMisconfiguration, "Error configuring strategy: %s", err.Error())
-	}
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
 
-	logger.Info("Start processing queue")
-	context.Set("IsRunning", true)
-	if err := context.Strategy.Start(); err == nil {
-		if context.GetOrNil("StrategyInitiatedStop").(bool) {
-			context.SendTerminate(0)
-		}
-	} else {
-		logger.WithField("error", err).Fatal("Error running strategy")
-		utils.Quitf(utils.ExitCodeRuntimeError, "Error running strategy: %s", err.Error())
-	}
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
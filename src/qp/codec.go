@@ -0,0 +1,174 @@
+package qp
+
+import (
+	"context"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// ICodec - message body codec (compression, encoding, serialization format)
+type ICodec interface {
+	Configure(configuration map[string]interface{}) error
+	Decode(body interface{}) (interface{}, error)
+	Encode(body interface{}) (interface{}, error)
+}
+
+// CodecQueue - queue decorator which decodes bodies of consumed messages with the chain of codecs
+// (in order) and encodes bodies of published messages (in reverse order).
+// Message which can not be decoded is rejected and never reaches processors
+type CodecQueue struct {
+	IConsumableQueue
+	codecs []ICodec
+	logger *log.Entry
+}
+
+// PublishableCodecQueue - CodecQueue over publishable queue
+type PublishableCodecQueue struct {
+	CodecQueue
+}
+
+// decodedMessage - message with decoded body. Keeps original message for ack/reject
+type decodedMessage struct {
+	IMessage
+	body interface{}
+}
+
+// NewCodecQueue - wraps queue with codec chain. Returned queue is IPublishableQueue if wrapped queue is
+func NewCodecQueue(queue IConsumableQueue, codecs []ICodec) IConsumableQueue {
+	codecQueue := CodecQueue{
+		IConsumableQueue: queue,
+		codecs:           codecs,
+		logger: log.WithFields(log.Fields{
+			"type":  "queue",
+			"queue": queue.GetName(),
+		}),
+	}
+	if _, ok := queue.(IPublishableQueue); ok {
+		return &PublishableCodecQueue{codecQueue}
+	}
+	return &codecQueue
+}
+
+// Consume consumes a message and decodes its body
+func (q *CodecQueue) Consume(ctx context.Context) (IMessage, error) {
+	for {
+		message, err := q.IConsumableQueue.Consume(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		body := message.GetBody()
+		for _, codec := range q.codecs {
+			if body, err = codec.Decode(body); err != nil {
+				break
+			}
+		}
+
+		if err == nil {
+			if bytes, ok := body.([]byte); ok {
+				body = string(bytes)
+			}
+			return &decodedMessage{IMessage: message, body: body}, nil
+		}
+
+		q.logger.WithFields(log.Fields{
+			"message": message.GetID(),
+			"error":   err,
+		}).Warn("Can't decode message body. Message rejected")
+		if rejectError := q.IConsumableQueue.Reject(ctx, message); rejectError != nil {
+			q.logger.WithField("error", rejectError).Error("Error on MessageReject")
+		}
+	}
+}
+
+// Ack acknowledges original message
+func (q *CodecQueue) Ack(ctx context.Context, message IMessage) error {
+	return q.IConsumableQueue.Ack(ctx, original(message))
+}
+
+// Reject rejects original message
+func (q *CodecQueue) Reject(ctx context.Context, message IMessage) error {
+	return q.IConsumableQueue.Reject(ctx, original(message))
+}
+
+// Delay delays original message if wrapped queue supports it
+func (q *CodecQueue) Delay(ctx context.Context, message IMessage, delay time.Duration) error {
+	delayable, ok := q.IConsumableQueue.(IDelayableQueue)
+	if !ok {
+		return ErrDelayNotSupported
+	}
+	return delayable.Delay(ctx, original(message), delay)
+}
+
+// Close closes wrapped queue if it holds any resources
+func (q *CodecQueue) Close() error {
+	if closable, ok := q.IConsumableQueue.(IClosable); ok {
+		return closable.Close()
+	}
+	return nil
+}
+
+// Publish encodes message body and publishes it
+func (q *PublishableCodecQueue) Publish(ctx context.Context, message IMessage) error {
+	body := message.GetBody()
+	for i := len(q.codecs) - 1; i >= 0; i-- {
+		var err error
+		if body, err = q.codecs[i].Encode(body); err != nil {
+			return fmt.Errorf("Can't encode message body: %s", err.Error())
+		}
+	}
+	if bytes, ok := body.([]byte); ok {
+		body = string(bytes)
+	}
+
+	return q.IConsumableQueue.(IPublishableQueue).Publish(ctx, &Message{
+		ID:         message.GetID(),
+		Body:       body,
+		Raw:        message.GetRaw(),
+		Attributes: message.GetAttributes(),
+	})
+}
+
+// OriginalBody returns body of the message as it was consumed from the queue, before codecs decoded it
+func OriginalBody(message IMessage) interface{} {
+	return original(message).GetBody()
+}
+
+// PublishEncoded publishes message whose body is already encoded (e.g. OriginalBody of consumed message)
+// skipping codecs of the queue
+func PublishEncoded(ctx context.Context, queue IPublishableQueue, message IMessage) error {
+	if codecQueue, ok := queue.(*PublishableCodecQueue); ok {
+		return codecQueue.IConsumableQueue.(IPublishableQueue).Publish(ctx, message)
+	}
+	return queue.Publish(ctx, message)
+}
+
+// GetBody returns decoded body
+func (m *decodedMessage) GetBody() interface{} {
+	return m.body
+}
+
+// Serialize returns serialized representation of message with decoded body
+func (m *decodedMessage) Serialize() (string, error) {
+	return (&Message{
+		ID:         m.GetID(),
+		Body:       m.body,
+		Raw:        m.GetRaw(),
+		Attributes: m.GetAttributes(),
+	}).Serialize()
+}
+
+// original returns message as it was consumed from the queue, without decorators
+func original(message IMessage) IMessage {
+	for {
+		switch wrapped := message.(type) {
+		case *decodedMessage:
+			message = wrapped.IMessage
+		case *routedMessage:
+			message = wrapped.IMessage
+		default:
+			return message
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package qp
 
 import (
+	"context"
 	log "github.com/Sirupsen/logrus"
 	"github.com/iVariable/qp/src/utils"
 	"os"
@@ -17,16 +18,22 @@ const (
 	ControlSignalTerminate = 3
 	ControlSignalTerminateGraceful = 4
 	ControlSignalStatus = 5
+	ControlSignalReload = 6
+	ControlSignalPing = 7
 )
 
+// cancellationGrace - time given to cancelled jobs to finish on forced shutdown
+const cancellationGrace = 5 * time.Second
 
 type (
 	// Config - application configuration
 	Config struct {
 		General struct {
-					Log struct {
-							Level string
-						}
+					Log LogConfig
+					Tracing TracingConfig
+					Health HealthConfig
+					ControlSocket string `yaml:"controlSocket"`
+					ShutdownTimeout int `yaml:"shutdownTimeout"`
 				}
 		Strategy []struct {
 			Name    string
@@ -37,15 +44,64 @@ type (
 			Name    string
 			Type    string
 			Options map[string]interface{}
+			Codecs  []struct {
+				Type    string
+				Options map[string]interface{}
+			}
 		}
 		Processor []struct {
 			Name    string
 			Type    string
 			Options map[string]interface{}
 		}
+		Middleware []struct {
+			Name    string
+			Type    string
+			Options map[string]interface{}
+		}
+
+		// Path - file configuration was loaded from, it is read again on reload
+		Path string `yaml:"-"`
+		// Overrides - changes applied on top of the file (e.g. command line flags), applied again on reload
+		Overrides []func(config *Config) error `yaml:"-"`
+	}
+
+	// LogConfig - logging configuration: level, format (text or json) and output (stderr, stdout, file or syslog).
+	// Log file is rotated when it grows over MaxSize megabytes
+	LogConfig struct {
+		Level      string
+		Format     string
+		Output     string
+		File       string
+		MaxSize    int `yaml:"maxSize"`
+		MaxBackups int `yaml:"maxBackups"`
+		MaxAge     int `yaml:"maxAge"`
+		Compress   bool
+		// Syslog - address (host:port) of syslog server, local syslog is used if empty
+		Syslog string
 	}
 
-	// Context - application context
+	// TracingConfig - tracing configuration. Spans are exported to OTLP collector (gRPC) or written to file as JSON.
+	// Tracing is disabled if Exporter is empty
+	TracingConfig struct {
+		Exporter    string
+		Endpoint    string
+		Insecure    bool
+		File        string
+		ServiceName string  `yaml:"serviceName"`
+		SampleRatio float64 `yaml:"sampleRatio"`
+	}
+
+	// HealthConfig - health endpoints (/healthz, /readyz) are served on Address, disabled if it is empty.
+	// Application is not ready if consume keeps failing longer than ConsumeTimeout seconds or its request
+	// to the queue is outstanding longer than ConsumeTimeout seconds after its long polling wait
+	HealthConfig struct {
+		Address        string
+		ConsumeTimeout int `yaml:"consumeTimeout"`
+	}
+
+	// Context - application context. Configuration and components are replaced on reload (see Replace),
+	// goroutines other than the one which loads them should read them under RLock
 	Context struct {
 		Configuration Config
 		Strategy      IProcessingStrategy
@@ -53,11 +109,18 @@ type (
 		AvailableQueues     map[string]*IConsumableQueue
 		AvailableProcessors map[string]*IProcessor
 		AvailableStrategies map[string]*IProcessingStrategy
+		AvailableMiddleware map[string]*IMiddleware
 
-		control   chan ControlSignal
-		data      map[string]interface{}
-		dataMutex sync.RWMutex
-		logger    *log.Entry
+		control          chan ControlSignal
+		terminated       chan struct{}
+		processing       context.Context
+		cancelProcessing context.CancelFunc
+		data             map[string]interface{}
+		dataMutex        sync.RWMutex
+		terminateHooks   []func()
+		hooksMutex       sync.Mutex
+		componentsMutex  sync.RWMutex
+		logger           *log.Entry
 	}
 
 	// ControlSignal - application flow control signal
@@ -69,12 +132,17 @@ type (
 
 // NewContext - constructor for Context
 func NewContext(config *Config) *Context {
+	processing, cancelProcessing := context.WithCancel(context.Background())
 	context := Context{
 		data:                make(map[string]interface{}),
 		control:             make(chan ControlSignal),
+		terminated:          make(chan struct{}),
+		processing:          processing,
+		cancelProcessing:    cancelProcessing,
 		AvailableQueues:     make(map[string]*IConsumableQueue),
 		AvailableProcessors: make(map[string]*IProcessor),
 		AvailableStrategies: make(map[string]*IProcessingStrategy),
+		AvailableMiddleware: make(map[string]*IMiddleware),
 		Configuration:       *config,
 		logger:              log.WithField("type", "context"),
 	}
@@ -83,41 +151,35 @@ func NewContext(config *Config) *Context {
 		context.Configuration.General.Log.Level = "warn"
 	}
 
+	if context.Configuration.General.Log.Format == "" {
+		context.Configuration.General.Log.Format = "text"
+	}
+
+	if context.Configuration.General.Log.Output == "" {
+		context.Configuration.General.Log.Output = "stderr"
+	}
+
+	if context.Configuration.General.Health.ConsumeTimeout <= 0 {
+		context.Configuration.General.Health.ConsumeTimeout = 60
+	}
+
+	if context.Configuration.General.ShutdownTimeout <= 0 {
+		context.Configuration.General.ShutdownTimeout = 30
+	}
+
 	return &context
 }
 
-// DispatchLoop - runs application dispatch loop
-func (c *Context) DispatchLoop(run, stop, status func(c *Context)) {
+// DispatchLoop - runs application dispatch loop until terminate signal is received.
+// Terminate hooks are run before it returns, returned value is exit code of the application
+func (c *Context) DispatchLoop(run, stop, status, reload func(c *Context)) int {
 	c.logger.Debug("Entering DispatchLoop")
-	go func() {
-		signals := make(chan os.Signal, 1)
-		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
-
-		go func() {
-			for {
-				sig := <-signals
-				c.logger.WithField("signal", sig).Debug("OS signal caught")
-				switch sig {
-				case syscall.SIGUSR1:
-					c.SendStatus()
-				case syscall.SIGINT:
-					fallthrough
-				case syscall.SIGTERM:
-					c.logger.Info("Shutting down gracefully")
-					c.SendTerminateGraceful()
-
-					select {
-					case <-time.After(30 * time.Second): //TODO make configurable
-						c.logger.Info("Shutting down forced after 30 secs")
-						c.SendTerminate(utils.ExitCodeShutdownForced)
-					case <-signals:
-						c.logger.Info("Shutfown forced because of second signal")
-						c.SendTerminate(utils.ExitCodeShutdownForced)
-					}
-				}
-			}
-		}()
-	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	defer close(c.terminated)
+
+	go c.handleSignals(signals)
 
 	for signal := range c.control {
 		c.logger.WithField("signal", signal).Debug("Flow signal caught")
@@ -131,26 +193,192 @@ func (c *Context) DispatchLoop(run, stop, status func(c *Context)) {
 		case ControlSignalStop:
 			c.logger.Debug("Received STOP signal")
 			go stop(c)
+		case ControlSignalReload:
+			c.logger.Debug("Received RELOAD signal")
+			go reload(c)
+		case ControlSignalPing:
+			// dispatch loop is alive, see IsAlive
 		case ControlSignalTerminate:
 			c.logger.Debug("Received TERMINATE signal")
-			utils.Quit(signal.ExitCode)
+			c.runTerminateHooks()
+			return signal.ExitCode
 		case ControlSignalTerminateGraceful:
 			c.logger.Debug("Received TERMINATE_GRACEFUL signal.")
 			go func() {
 				stop(c)
+				if c.processing.Err() != nil {
+					c.logger.Debug("Forced exit performed")
+					c.SendTerminate(utils.ExitCodeShutdownForced)
+					return
+				}
 				c.logger.Debug("Normal exit performed")
 				c.SendTerminate(utils.ExitCodeOk)
 			}()
 		default:
-			c.logger.Fatal("Unknown control signal received")
-			utils.Quitf(utils.ExitCodeRuntimeError, "Unknown control signal received")
+			c.logger.WithField("signal", signal).Error("Unknown control signal received")
+			c.runTerminateHooks()
+			return utils.ExitCodeRuntimeError
 		}
 	}
+	return utils.ExitCodeOk
 }
 
+// handleSignals turns OS signals into control signals until dispatch loop terminates.
+// Second SIGINT/SIGTERM or shutdown timeout force the shutdown: running jobs are cancelled
+func (c *Context) handleSignals(signals chan os.Signal) {
+	for {
+		var sig os.Signal
+		select {
+		case sig = <-signals:
+		case <-c.terminated:
+			return
+		}
+		c.logger.WithField("signal", sig).Debug("OS signal caught")
+		switch sig {
+		case syscall.SIGUSR1:
+			c.SendStatus()
+		case syscall.SIGHUP:
+			c.SendReload()
+		case syscall.SIGINT:
+			fallthrough
+		case syscall.SIGTERM:
+			c.logger.Info("Shutting down gracefully")
+			c.SendTerminateGraceful()
+
+			c.RLock()
+			timeout := c.Configuration.General.ShutdownTimeout
+			c.RUnlock()
+			switch c.waitTerminateSignal(signals, time.Duration(timeout)*time.Second) {
+			case waitTerminated:
+				return
+			case waitSignal:
+				c.logger.Info("Shutfown forced because of second signal")
+			default:
+				c.logger.WithField("shutdownTimeout", timeout).Info("Shutting down forced after shutdown timeout")
+			}
+			c.logAbandoned()
+			c.CancelProcessing()
+
+			// cancelled jobs are given a moment to be released, graceful stop exits on its own
+			if c.waitTerminateSignal(signals, cancellationGrace) == waitTerminated {
+				return
+			}
+			c.SendTerminate(utils.ExitCodeShutdownForced)
+		}
+	}
+}
+
+// waitTerminateSignal results
+const (
+	waitTimeout = iota
+	waitSignal
+	waitTerminated
+)
+
+// waitTerminateSignal waits for SIGINT/SIGTERM at most timeout, other signals are ignored.
+// Waiting stops when dispatch loop terminates
+func (c *Context) waitTerminateSignal(signals chan os.Signal, timeout time.Duration) int {
+	expired := time.After(timeout)
+	for {
+		select {
+		case <-expired:
+			return waitTimeout
+		case <-c.terminated:
+			return waitTerminated
+		case sig := <-signals:
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				return waitSignal
+			}
+		}
+	}
+}
+
+// logAbandoned logs jobs which are still in processing on forced shutdown
+func (c *Context) logAbandoned() {
+	inFlightAware, ok := c.CurrentStrategy().(IInFlightAware)
+	if !ok {
+		return
+	}
+	if ids := inFlightAware.GetInFlight(); len(ids) > 0 {
+		c.logger.WithFields(log.Fields{
+			"jobs":     len(ids),
+			"messages": ids,
+		}).Warn("In-flight jobs abandoned")
+	}
+}
+
+// RLock - lock configuration and components for reading
+func (c *Context) RLock() {
+	c.componentsMutex.RLock()
+}
+
+// RUnlock - unlock configuration and components locked by RLock
+func (c *Context) RUnlock() {
+	c.componentsMutex.RUnlock()
+}
+
+// CurrentStrategy - strategy of the context, it is replaced on reload
+func (c *Context) CurrentStrategy() IProcessingStrategy {
+	c.RLock()
+	defer c.RUnlock()
+	return c.Strategy
+}
+
+// Replace - replace configuration and components with ones of staged context (configuration reload)
+func (c *Context) Replace(staged *Context) {
+	c.componentsMutex.Lock()
+	c.Configuration = staged.Configuration
+	c.AvailableQueues = staged.AvailableQueues
+	c.AvailableMiddleware = staged.AvailableMiddleware
+	c.AvailableProcessors = staged.AvailableProcessors
+	c.AvailableStrategies = staged.AvailableStrategies
+	c.Strategy = staged.Strategy
+	c.componentsMutex.Unlock()
+}
+
+// ReplaceGeneral - replace general section of configuration (reload which does not change components)
+func (c *Context) ReplaceGeneral(config *Config) {
+	c.componentsMutex.Lock()
+	c.Configuration.General = config.General
+	c.componentsMutex.Unlock()
+}
+
+// OnTerminate - register function called before application exits (e.g. to flush buffered data)
+func (c *Context) OnTerminate(hook func()) {
+	c.hooksMutex.Lock()
+	c.terminateHooks = append(c.terminateHooks, hook)
+	c.hooksMutex.Unlock()
+}
+
+func (c *Context) runTerminateHooks() {
+	c.hooksMutex.Lock()
+	hooks := c.terminateHooks
+	c.terminateHooks = nil
+	c.hooksMutex.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// ProcessingContext - context of jobs processing. It is cancelled on forced shutdown
+func (c *Context) ProcessingContext() context.Context {
+	return c.processing
+}
+
+// CancelProcessing - cancel all running jobs
+func (c *Context) CancelProcessing() {
+	c.logger.Info("Cancelling running jobs")
+	c.cancelProcessing()
+}
+
+// sendControlSignal passes signal to dispatch loop. Signals sent after the loop returned are dropped
 func (c *Context) sendControlSignal(signal ControlSignal) {
 	c.logger.WithField("signal", signal).Debug("Control signal sent")
-	c.control <- signal
+	select {
+	case c.control <- signal:
+	case <-c.terminated:
+		c.logger.WithField("signal", signal).Debug("Control signal dropped, dispatch loop terminated")
+	}
 }
 
 // SendRun - send run control signal
@@ -168,6 +396,11 @@ func (c *Context) SendTerminateGraceful() {
 	c.sendControlSignal(ControlSignal{Signal: ControlSignalTerminateGraceful})
 }
 
+// SendReload - send reload control signal. Configuration is read again and changed components are restarted
+func (c *Context) SendReload() {
+	c.sendControlSignal(ControlSignal{Signal: ControlSignalReload})
+}
+
 // SendStop - send stop control signal
 func (c *Context) SendStop() {
 	c.sendControlSignal(ControlSignal{Signal: ControlSignalStop})
@@ -0,0 +1,127 @@
+package qp
+
+import "sync"
+
+// Job verdict constants
+const (
+	VerdictNone       = ""
+	VerdictAck        = "ack"
+	VerdictReject     = "reject"
+	VerdictDeadLetter = "deadletter"
+)
+
+// IDeadLetterAwareJob - job which records that its message was published to dead-letter queue
+type IDeadLetterAwareJob interface {
+	DeadLetterMessage() error
+}
+
+// AckDeadLettered acknowledges job whose message was published to dead-letter queue.
+// Composed processors (see DeferredJob) get dead-letter verdict and stop processing of the message
+func AckDeadLettered(job IJob) error {
+	if deadLetterAware, ok := job.(IDeadLetterAwareJob); ok {
+		return deadLetterAware.DeadLetterMessage()
+	}
+	return job.AckMessage()
+}
+
+// DeferredJob - job wrapper which records ack/reject verdict instead of passing it to the queue.
+// Used by composed processors to decide on the real verdict themselves
+type DeferredJob struct {
+	job           IJob
+	message       IMessage
+	verdict       string
+	failureReason string
+	mutex         sync.Mutex
+}
+
+// NewDeferredJob - constructor for DeferredJob
+func NewDeferredJob(job IJob) *DeferredJob {
+	return &DeferredJob{
+		job:     job,
+		message: job.GetMessage(),
+	}
+}
+
+// GetMessage returns message
+func (j *DeferredJob) GetMessage() IMessage {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.message
+}
+
+// SetMessage replaces message seen by processors, queue message stays untouched
+func (j *DeferredJob) SetMessage(message IMessage) {
+	j.mutex.Lock()
+	j.message = message
+	j.mutex.Unlock()
+}
+
+// AckMessage records ack verdict
+func (j *DeferredJob) AckMessage() error {
+	j.mutex.Lock()
+	j.verdict = VerdictAck
+	j.mutex.Unlock()
+	return nil
+}
+
+// RejectMessage records reject verdict
+func (j *DeferredJob) RejectMessage() error {
+	j.mutex.Lock()
+	j.verdict = VerdictReject
+	j.mutex.Unlock()
+	return nil
+}
+
+// DeadLetterMessage records dead-letter verdict
+func (j *DeferredJob) DeadLetterMessage() error {
+	j.mutex.Lock()
+	j.verdict = VerdictDeadLetter
+	j.mutex.Unlock()
+	return nil
+}
+
+// GetVerdict returns recorded verdict
+func (j *DeferredJob) GetVerdict() string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.verdict
+}
+
+// GetAttempt returns attempt of the wrapped job
+func (j *DeferredJob) GetAttempt() int {
+	if attemptAware, ok := j.job.(interface {
+		GetAttempt() int
+	}); ok {
+		return attemptAware.GetAttempt()
+	}
+	return 1
+}
+
+// SetFailureReason sets reason of job failure
+func (j *DeferredJob) SetFailureReason(reason string) {
+	j.mutex.Lock()
+	j.failureReason = reason
+	j.mutex.Unlock()
+}
+
+// GetFailureReason returns reason of job failure
+func (j *DeferredJob) GetFailureReason() string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.failureReason
+}
+
+// GetValue returns value stored on wrapped job
+func (j *DeferredJob) GetValue(key string) interface{} {
+	if valuesAware, ok := j.job.(IValuesAwareJob); ok {
+		return valuesAware.GetValue(key)
+	}
+	return nil
+}
+
+// SetValue stores value on wrapped job, values are kept between attempts of the message
+func (j *DeferredJob) SetValue(key string, value interface{}) {
+	if valuesAware, ok := j.job.(IValuesAwareJob); ok {
+		valuesAware.SetValue(key, value)
+	}
+}
@@ -0,0 +1,36 @@
+package qp
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDelayNotSupported - returned by IDelayableQueue which can't delay messages (e.g. wrapper of ordinary queue)
+var ErrDelayNotSupported = errors.New("Queue does not support message delay")
+
+// IDelayableQueue - queue which can hide consumed message and deliver it again after delay (e.g. SQS visibility timeout).
+// Delay 0 returns message to the queue right away
+type IDelayableQueue interface {
+	IConsumableQueue
+	Delay(ctx context.Context, message IMessage, delay time.Duration) error
+}
+
+// IPrefetchingQueue - queue which consumes messages ahead (e.g. WeightedQueue)
+type IPrefetchingQueue interface {
+	IConsumableQueue
+	StopPrefetch(release func(message IMessage))
+}
+
+// IEnqueuedAtAware - message which knows when it was sent to the queue
+type IEnqueuedAtAware interface {
+	GetEnqueuedAt() time.Time
+}
+
+// GetEnqueuedAt returns time when message was sent to the queue, zero if unknown
+func GetEnqueuedAt(message IMessage) time.Time {
+	if enqueuedAtAware, ok := original(message).(IEnqueuedAtAware); ok {
+		return enqueuedAtAware.GetEnqueuedAt()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,170 @@
+package qp
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Readiness checks
+const (
+	HealthCheckStrategy = "strategy"
+	HealthCheckConsume  = "consume"
+	HealthCheckCircuit  = "circuit"
+)
+
+type (
+	// ConsumeState - result of the last consume of the strategy
+	ConsumeState struct {
+		// LastSucceededAt - when message was consumed last time (zero if nothing was consumed yet)
+		LastSucceededAt time.Time
+		// LastError - error of the last consume, nil if it succeeded or no consume finished yet
+		LastError error
+		// PollStartedAt - when the oldest outstanding request of consume to the queue started, zero if there is none
+		// (see ReportPoll)
+		PollStartedAt time.Time
+		// PollWait - time the oldest outstanding request may wait for messages (long polling)
+		PollWait time.Duration
+	}
+
+	// IConsumeStateAware - strategy which reports result of the last consume
+	IConsumeStateAware interface {
+		GetConsumeState() ConsumeState
+	}
+
+	// ICircuitBreaker - processor or middleware with circuit breaker. Application is not ready while circuit is open
+	ICircuitBreaker interface {
+		IsCircuitOpen() bool
+	}
+
+	// HealthCheck - result of one readiness check
+	HealthCheck struct {
+		Name    string `json:"name"`
+		OK      bool   `json:"ok"`
+		Message string `json:"message,omitempty"`
+	}
+
+	// Readiness - readiness of the application: all checks passed
+	Readiness struct {
+		Ready  bool          `json:"ready"`
+		Checks []HealthCheck `json:"checks"`
+	}
+)
+
+// pollReporterKey - context key of consume poll reporter, see WithPollReporter
+type pollReporterKey struct{}
+
+// WithPollReporter returns consume ctx whose requests to the queue are reported to report (see ReportPoll).
+// report is called when request starts, returned function when it is finished
+func WithPollReporter(ctx context.Context, report func(wait time.Duration) func()) context.Context {
+	return context.WithValue(ctx, pollReporterKey{}, report)
+}
+
+// ReportPoll - long-polling queue reports request which may wait for messages up to wait before it is sent,
+// returned function should be called when request is finished. Consume whose request is outstanding longer
+// than wait plus general.health.consumeTimeout is hung. Consume waiting for messages without requests
+// (e.g. Tail) is not checked
+func ReportPoll(ctx context.Context, wait time.Duration) func() {
+	if report, ok := ctx.Value(pollReporterKey{}).(func(wait time.Duration) func()); ok {
+		return report(wait)
+	}
+	return func() {}
+}
+
+// withPollReporterOf returns ctx with poll reporter of from, if any
+func withPollReporterOf(ctx context.Context, from context.Context) context.Context {
+	if report, ok := from.Value(pollReporterKey{}).(func(wait time.Duration) func()); ok {
+		return WithPollReporter(ctx, report)
+	}
+	return ctx
+}
+
+// IsAlive - dispatch loop accepts control signals within timeout
+func (c *Context) IsAlive(timeout time.Duration) bool {
+	select {
+	case c.control <- ControlSignal{Signal: ControlSignalPing}:
+		return true
+	case <-c.terminated:
+		return false
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Readiness - checks strategy is running, consume does not fail or hang for longer than
+// general.health.consumeTimeout seconds and circuit of processors and middleware is not open
+func (c *Context) Readiness() Readiness {
+	c.RLock()
+	defer c.RUnlock()
+	var checks []HealthCheck
+	if c.Strategy == nil {
+		checks = append(checks, HealthCheck{Name: HealthCheckStrategy, Message: "strategy is not configured"})
+	} else {
+		stats := c.Strategy.GetStatistics()
+		checks = append(checks, checkStrategy(stats), c.checkConsume(stats))
+	}
+	checks = append(checks, c.checkCircuit())
+
+	readiness := Readiness{Ready: true, Checks: checks}
+	for _, check := range checks {
+		if !check.OK {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
+
+func checkStrategy(stats Statistics) HealthCheck {
+	check := HealthCheck{Name: HealthCheckStrategy, OK: true}
+	if stats.Status != StatusRunning {
+		check.OK, check.Message = false, "strategy is "+stats.Status
+	}
+	return check
+}
+
+// checkConsume fails when consume keeps failing longer than consume timeout or request of consume to the queue
+// is outstanding longer than its long polling wait plus consume timeout. Waiting for messages on empty queue
+// is not a failure
+func (c *Context) checkConsume(stats Statistics) HealthCheck {
+	check := HealthCheck{Name: HealthCheckConsume, OK: true}
+	aware, ok := c.Strategy.(IConsumeStateAware)
+	if !ok {
+		return check
+	}
+	state := aware.GetConsumeState()
+	timeout := time.Duration(c.Configuration.General.Health.ConsumeTimeout) * time.Second
+	if !state.PollStartedAt.IsZero() && time.Since(state.PollStartedAt) > state.PollWait+timeout {
+		check.OK = false
+		check.Message = fmt.Sprintf("consume is waiting for the queue for %s", time.Since(state.PollStartedAt).Round(time.Second))
+		return check
+	}
+	if state.LastError == nil {
+		return check
+	}
+	since := state.LastSucceededAt
+	if stats.StartedAt.After(since) {
+		since = stats.StartedAt
+	}
+	if time.Since(since) > timeout {
+		check.OK = false
+		check.Message = fmt.Sprintf("consume is failing for %s: %s", time.Since(since).Round(time.Second), state.LastError.Error())
+	}
+	return check
+}
+
+func (c *Context) checkCircuit() HealthCheck {
+	check := HealthCheck{Name: HealthCheckCircuit, OK: true}
+	for name, processor := range c.AvailableProcessors {
+		if breaker, ok := (*processor).(ICircuitBreaker); ok && breaker.IsCircuitOpen() {
+			check.OK, check.Message = false, fmt.Sprintf("circuit of processor %q is open", name)
+			return check
+		}
+	}
+	for name, middleware := range c.AvailableMiddleware {
+		if breaker, ok := (*middleware).(ICircuitBreaker); ok && breaker.IsCircuitOpen() {
+			check.OK, check.Message = false, fmt.Sprintf("circuit of middleware %q is open", name)
+			return check
+		}
+	}
+	return check
+}
@@ -1,5 +1,12 @@
 package qp
 
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"sync"
+)
+
 // IJob job interface
 type IJob interface {
 	GetMessage() IMessage
@@ -7,17 +14,49 @@ type IJob interface {
 	RejectMessage() error
 }
 
+// IFailureAwareJob - job which can carry human-readable reason of its failure
+type IFailureAwareJob interface {
+	IJob
+	SetFailureReason(reason string)
+	GetFailureReason() string
+}
+
+// IMutableJob - job which message can be replaced (e.g. transformed) for the following processors
+type IMutableJob interface {
+	IJob
+	SetMessage(message IMessage)
+}
+
+// IValuesAwareJob - job which keeps values of processors between processing attempts of the message
+// (retries of the strategy or Retry middleware). Message redelivered by the queue starts without values
+type IValuesAwareJob interface {
+	IJob
+	GetValue(key string) interface{}
+	SetValue(key string, value interface{})
+}
+
 // SimpleJob - simple job implementation
 type SimpleJob struct {
-	queue   IConsumableQueue
-	message IMessage
+	queue         IConsumableQueue
+	message       IMessage
+	attempt       int
+	correlationID string
+	ctx           context.Context
+	traceContext  context.Context
+	failureReason string
+	acknowledged  bool
+	rejected      bool
+	values        map[string]interface{}
+	valuesMutex   sync.Mutex
 }
 
 // NewSimpleJob Simple job constructor
 func NewSimpleJob(q IConsumableQueue, m IMessage) *SimpleJob {
 	return &SimpleJob{
-		queue:   q,
-		message: m}
+		queue:         q,
+		message:       m,
+		attempt:       1,
+		correlationID: NewCorrelationID(m)}
 }
 
 // GetMessage returns message
@@ -27,10 +66,186 @@ func (j *SimpleJob) GetMessage() IMessage {
 
 // AckMessage acknowledges message
 func (j *SimpleJob) AckMessage() error {
-	return j.queue.Ack(j.message)
+	ctx, span := StartSpan(j.GetContext(), j.GetTraceContext(), "qp.ack", j.spanAttributes()...)
+	if err := j.queue.Ack(ctx, j.message); err != nil {
+		EndSpan(span, err)
+		return err
+	}
+	j.acknowledged = true
+	EndSpan(span, nil)
+	return nil
+}
+
+// IsAcknowledged returns true if message was successfully acknowledged
+func (j *SimpleJob) IsAcknowledged() bool {
+	return j.acknowledged
 }
 
 // RejectMessage rejects message
 func (j *SimpleJob) RejectMessage() error {
-	return j.queue.Reject(j.message)
+	ctx, span := StartSpan(j.GetContext(), j.GetTraceContext(), "qp.reject", j.spanAttributes()...)
+	if j.failureReason != "" {
+		span.SetAttributes(attribute.String("qp.failure_reason", j.failureReason))
+	}
+	if err := j.queue.Reject(ctx, j.message); err != nil {
+		EndSpan(span, err)
+		return err
+	}
+	j.rejected = true
+	EndSpan(span, nil)
+	return nil
+}
+
+// GetContext returns context of queue operations (ack, reject) of the job
+func (j *SimpleJob) GetContext() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// SetContext sets context of queue operations of the job, they are interrupted when it is cancelled
+func (j *SimpleJob) SetContext(ctx context.Context) {
+	j.ctx = ctx
+}
+
+// GetTraceContext returns context with span of the job (consume span), spans of the job are its children
+func (j *SimpleJob) GetTraceContext() context.Context {
+	if j.traceContext == nil {
+		return context.Background()
+	}
+	return j.traceContext
+}
+
+// SetTraceContext sets context with span of the job
+func (j *SimpleJob) SetTraceContext(ctx context.Context) {
+	j.traceContext = ctx
+}
+
+func (j *SimpleJob) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.message.id", fmt.Sprint(j.message.GetID())),
+		attribute.Int("qp.attempt", j.attempt),
+		attribute.String("qp.correlation_id", j.correlationID),
+	}
+}
+
+// IsRejected returns true if message was successfully rejected
+func (j *SimpleJob) IsRejected() bool {
+	return j.rejected
+}
+
+// GetAttempt returns number of current processing attempt, starting from 1
+func (j *SimpleJob) GetAttempt() int {
+	return j.attempt
+}
+
+// Retry registers one more processing attempt
+func (j *SimpleJob) Retry() {
+	j.attempt++
+}
+
+// GetCorrelationID returns correlation ID of the job, it is kept across retries
+func (j *SimpleJob) GetCorrelationID() string {
+	return j.correlationID
+}
+
+// GetValue returns value stored by processor, nil if there is none
+func (j *SimpleJob) GetValue(key string) interface{} {
+	j.valuesMutex.Lock()
+	defer j.valuesMutex.Unlock()
+	return j.values[key]
+}
+
+// SetValue stores value of processor, nil value removes it
+func (j *SimpleJob) SetValue(key string, value interface{}) {
+	j.valuesMutex.Lock()
+	defer j.valuesMutex.Unlock()
+	if value == nil {
+		delete(j.values, key)
+		return
+	}
+	if j.values == nil {
+		j.values = make(map[string]interface{})
+	}
+	j.values[key] = value
+}
+
+// SetFailureReason sets reason of job failure
+func (j *SimpleJob) SetFailureReason(reason string) {
+	j.failureReason = reason
+}
+
+// GetFailureReason returns reason of job failure
+func (j *SimpleJob) GetFailureReason() string {
+	return j.failureReason
+}
+
+// RewrittenJob - job wrapper with replaced message. Ack and reject are passed to the wrapped job
+type RewrittenJob struct {
+	job     IJob
+	message IMessage
+}
+
+// NewRewrittenJob - constructor for RewrittenJob
+func NewRewrittenJob(job IJob, message IMessage) *RewrittenJob {
+	return &RewrittenJob{
+		job:     job,
+		message: message,
+	}
+}
+
+// GetMessage returns replaced message
+func (j *RewrittenJob) GetMessage() IMessage {
+	return j.message
+}
+
+// AckMessage acknowledges wrapped job
+func (j *RewrittenJob) AckMessage() error {
+	return j.job.AckMessage()
+}
+
+// RejectMessage rejects wrapped job
+func (j *RewrittenJob) RejectMessage() error {
+	return j.job.RejectMessage()
+}
+
+// GetAttempt returns attempt of the wrapped job
+func (j *RewrittenJob) GetAttempt() int {
+	if attemptAware, ok := j.job.(interface {
+		GetAttempt() int
+	}); ok {
+		return attemptAware.GetAttempt()
+	}
+	return 1
+}
+
+// SetFailureReason sets reason of wrapped job failure
+func (j *RewrittenJob) SetFailureReason(reason string) {
+	if failureAware, ok := j.job.(IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+}
+
+// GetFailureReason returns reason of wrapped job failure
+func (j *RewrittenJob) GetFailureReason() string {
+	if failureAware, ok := j.job.(IFailureAwareJob); ok {
+		return failureAware.GetFailureReason()
+	}
+	return ""
+}
+
+// GetValue returns value stored on wrapped job
+func (j *RewrittenJob) GetValue(key string) interface{} {
+	if valuesAware, ok := j.job.(IValuesAwareJob); ok {
+		return valuesAware.GetValue(key)
+	}
+	return nil
+}
+
+// SetValue stores value on wrapped job
+func (j *RewrittenJob) SetValue(key string, value interface{}) {
+	if valuesAware, ok := j.job.(IValuesAwareJob); ok {
+		valuesAware.SetValue(key, value)
+	}
 }
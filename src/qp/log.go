@@ -0,0 +1,73 @@
+package qp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	log "github.com/Sirupsen/logrus"
+)
+
+// CorrelationIDAttribute - message attribute with correlation ID set by producer. Messages without it get generated one
+const CorrelationIDAttribute = "CorrelationId"
+
+// Log fields of the job being processed. Component fields (e.g. "processor": "Shell") hold component type,
+// job fields hold names of configured components
+const (
+	LogFieldStrategy      = "strategy_name"
+	LogFieldQueue         = "queue_name"
+	LogFieldProcessor     = "processor_name"
+	LogFieldWorker        = "worker"
+	LogFieldMessageID     = "message_id"
+	LogFieldAttempt       = "attempt"
+	LogFieldCorrelationID = "correlation_id"
+	LogFieldDuration      = "duration"
+)
+
+type logFieldsKey struct{}
+
+// WithLogFields returns ctx carrying log fields of the job being processed (in addition to fields already in ctx)
+func WithLogFields(ctx context.Context, fields log.Fields) context.Context {
+	merged := make(log.Fields)
+	for name, value := range LogFields(ctx) {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+// LogFields returns log fields of the job being processed
+func LogFields(ctx context.Context) log.Fields {
+	fields, _ := ctx.Value(logFieldsKey{}).(log.Fields)
+	return fields
+}
+
+// JobLogger returns logger of the component with fields of the job being processed
+func JobLogger(ctx context.Context, logger *log.Entry) *log.Entry {
+	fields := LogFields(ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.WithFields(fields)
+}
+
+// CorrelationID returns correlation ID of the job being processed, empty if ctx does not belong to a job.
+// Correlation ID of a batch is comma-separated list of correlation IDs of its jobs in batch order.
+// Processors pass it on (HTTP header, environment variable, etc) so one message can be traced end to end
+func CorrelationID(ctx context.Context) string {
+	id, _ := LogFields(ctx)[LogFieldCorrelationID].(string)
+	return id
+}
+
+// NewCorrelationID returns correlation ID of the message: value of CorrelationIDAttribute or random one
+func NewCorrelationID(message IMessage) string {
+	if id := message.GetAttributes()[CorrelationIDAttribute]; id != "" {
+		return id
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
@@ -1,7 +1,64 @@
 package qp
 
-// IProcessor job processor interface
+import "context"
+
+// IProcessor job processor interface.
+// Processing should stop when ctx is cancelled (forced shutdown or job deadline)
 type IProcessor interface {
 	Configure(configuration map[string]interface{}) error
-	Process(job IJob) error
+	Process(ctx context.Context, job IJob) error
+}
+
+// IBatchProcessor - processor which handles several jobs at once (e.g. bulk endpoints).
+// Every job of the batch is acknowledged or rejected by the processor.
+// If RetryError is returned, jobs left unresolved are retried by strategy
+type IBatchProcessor interface {
+	IProcessor
+	ProcessBatch(ctx context.Context, jobs []IJob) error
+}
+
+// IBatchSupportChecker - batch processor whose configuration may not allow batches (e.g. per-message settings).
+// CheckBatchSupport returns the reason, strategy with BatchSize > 1 fails to configure then
+type IBatchSupportChecker interface {
+	CheckBatchSupport() error
+}
+
+// ILinkable - component (processor, middleware) which uses other components of the context.
+// Link is called after all queues, middleware and processors are configured
+type ILinkable interface {
+	Link(context *Context) error
+}
+
+// IClosable - component (queue, processor, strategy) holding resources (connections, child processes, files)
+// which are freed when the component is replaced on configuration reload
+type IClosable interface {
+	Close() error
+}
+
+// IOptionsProvider - component (queue, processor, middleware, codec, strategy) configured with options struct
+// (see utils.Decode). Options returns new options struct, it is used to validate configuration without side effects.
+// Options referring other components are tagged with `ref:"queue"`, `ref:"processor"` or `ref:"middleware"`
+type IOptionsProvider interface {
+	Options() interface{}
+}
+
+// IOptionsValidator - options struct which checks values of decoded options (allowed values, bounds).
+// Returned *utils.DecodeError paths are relative to the options
+type IOptionsValidator interface {
+	Validate() error
+}
+
+// IComposedProcessor - processor which uses other processors, middleware or queues of the context
+type IComposedProcessor interface {
+	IProcessor
+	ILinkable
+}
+
+// ProcessFunc - job processing function, e.g. IProcessor.Process
+type ProcessFunc func(ctx context.Context, job IJob) error
+
+// IMiddleware - wraps job processing for cross-cutting concerns (logging, timing, retries, etc)
+type IMiddleware interface {
+	Configure(configuration map[string]interface{}) error
+	Wrap(next ProcessFunc) ProcessFunc
 }
@@ -1,15 +1,41 @@
 package qp
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
-// IConsumableQueue Consumable queue interface
+// IConsumableQueue Consumable queue interface.
+// Consume, Ack, Reject and GetNumberOfMessages should return ctx error as soon as ctx is cancelled
 type IConsumableQueue interface {
 	GetName() string
 	Configure(configuration map[string]interface{}) error
-	Consume() (IMessage, error)
-	Ack(message IMessage) error
-	Reject(message IMessage) error
-	GetNumberOfMessages() (int, error)
+	Consume(ctx context.Context) (IMessage, error)
+	Ack(ctx context.Context, message IMessage) error
+	Reject(ctx context.Context, message IMessage) error
+	GetNumberOfMessages(ctx context.Context) (int, error)
+}
+
+// IMessageIDAware - message which knows its ID kept across deliveries
+type IMessageIDAware interface {
+	GetMessageID() string
+}
+
+// GetMessageID returns ID of the message kept across deliveries (e.g. SQS MessageId). ID of the message
+// is returned if queue does not provide one
+func GetMessageID(message IMessage) string {
+	if messageIDAware, ok := original(message).(IMessageIDAware); ok {
+		return messageIDAware.GetMessageID()
+	}
+	return fmt.Sprint(message.GetID())
+}
+
+// IPublishableQueue - queue which accepts new messages (e.g. dead-letter queue)
+type IPublishableQueue interface {
+	IConsumableQueue
+	Publish(ctx context.Context, message IMessage) error
 }
 
 // IMessage - message interface
@@ -18,13 +44,18 @@ type IMessage interface {
 	GetID() interface{}
 	GetBody() interface{}
 	GetRaw() string
+	GetAttributes() map[string]string
 }
 
 // Message simple message struct
 type Message struct {
-	ID   interface{}
-	Body interface{}
-	Raw  string
+	ID         interface{}
+	Body       interface{}
+	Raw        string
+	Attributes map[string]string
+	EnqueuedAt time.Time `json:"-"`
+	// MessageID - ID of the message kept across deliveries, for queues whose ID changes on redelivery (SQS receipt handle)
+	MessageID string `json:"-"`
 }
 
 // GetID returns message id
@@ -41,6 +72,24 @@ func (m *Message) GetRaw() string {
 	return m.Raw
 }
 
+// GetAttributes returns message attributes (headers)
+func (m *Message) GetAttributes() map[string]string {
+	return m.Attributes
+}
+
+// GetEnqueuedAt returns time when message was sent to the queue, zero if unknown
+func (m *Message) GetEnqueuedAt() time.Time {
+	return m.EnqueuedAt
+}
+
+// GetMessageID returns ID of the message kept across deliveries, ID is used if it is not set
+func (m *Message) GetMessageID() string {
+	if m.MessageID != "" {
+		return m.MessageID
+	}
+	return fmt.Sprint(m.ID)
+}
+
 // Serialize returns serialized representation of message
 func (m *Message) Serialize() (string, error) {
 	jsonBytes, err := json.Marshal(m)
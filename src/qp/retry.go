@@ -0,0 +1,26 @@
+package qp
+
+import "time"
+
+// RetryError - returned by processor when job should be processed once again.
+// Processor must neither acknowledge nor reject the job in this case,
+// it is up to processing strategy to retry it or to reject it when retries are exhausted
+type RetryError struct {
+	Reason error
+	After  time.Duration
+}
+
+// NewRetryError - constructor for RetryError
+func NewRetryError(reason error, after time.Duration) *RetryError {
+	return &RetryError{
+		Reason: reason,
+		After:  after,
+	}
+}
+
+func (e *RetryError) Error() string {
+	if e.Reason == nil {
+		return "Retry requested"
+	}
+	return "Retry requested: " + e.Reason.Error()
+}
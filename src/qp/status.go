@@ -0,0 +1,81 @@
+package qp
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// Status - state of the running application, see Context.Status
+	Status struct {
+		Time       time.Time        `json:"time"`
+		Strategies []StrategyStatus `json:"strategies"`
+	}
+
+	// StrategyStatus - statistics of the strategy. Throughput (jobs per second) and error rate (failed part
+	// of finished jobs) are averaged since strategy start. QueueDepth is nil when it is unknown
+	StrategyStatus struct {
+		Name       string           `json:"name"`
+		Type       string           `json:"type"`
+		Status     string           `json:"status"`
+		StartedAt  time.Time        `json:"startedAt"`
+		Processed  int64            `json:"processed"`
+		Failed     int64            `json:"failed"`
+		InFlight   int              `json:"inFlight"`
+		QueueDepth *int64           `json:"queueDepth"`
+		Throughput float64          `json:"throughput"`
+		ErrorRate  float64          `json:"errorRate"`
+		Counters   map[string]int64 `json:"counters,omitempty"`
+	}
+)
+
+// Status - statistics of the strategy at the moment. Queue depth is requested from the queue of the strategy
+// (see IQueueAware) within ctx, other statistics are collected in memory
+func (c *Context) Status(ctx context.Context) Status {
+	status := Status{Time: time.Now()}
+	c.RLock()
+	if c.Strategy == nil || len(c.Configuration.Strategy) == 0 {
+		c.RUnlock()
+		return status
+	}
+	strategy, name, strategyType := c.Strategy, c.Configuration.Strategy[0].Name, c.Configuration.Strategy[0].Type
+	c.RUnlock()
+
+	stats := strategy.GetStatistics()
+	strategyStatus := StrategyStatus{
+		Name:      name,
+		Type:      strategyType,
+		Status:    stats.Status,
+		StartedAt: stats.StartedAt,
+		Processed: stats.ProcessedMessages.Int64(),
+		Failed:    stats.FailedMessaged.Int64(),
+		InFlight:  stats.InFlight,
+		Counters:  stats.Counters,
+	}
+	if queueAware, ok := strategy.(IQueueAware); ok {
+		if depth, err := queueAware.GetQueue().GetNumberOfMessages(ctx); err == nil {
+			queueDepth := int64(depth)
+			strategyStatus.QueueDepth = &queueDepth
+		} else {
+			c.logger.WithField("error", err).Debug("Can't get number of messages in queue")
+		}
+	}
+	if !stats.StartedAt.IsZero() {
+		strategyStatus.Throughput, strategyStatus.ErrorRate = Rates(strategyStatus.Processed, strategyStatus.Failed, status.Time.Sub(stats.StartedAt))
+	}
+	status.Strategies = append(status.Strategies, strategyStatus)
+	return status
+}
+
+// Rates returns throughput (finished jobs per second) and error rate (failed part of finished jobs)
+// of jobs processed and failed within elapsed time
+func Rates(processed int64, failed int64, elapsed time.Duration) (throughput float64, errorRate float64) {
+	finished := processed + failed
+	if elapsed > 0 {
+		throughput = float64(finished) / elapsed.Seconds()
+	}
+	if finished > 0 {
+		errorRate = float64(failed) / float64(finished)
+	}
+	return throughput, errorRate
+}
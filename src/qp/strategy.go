@@ -1,6 +1,7 @@
 package qp
 
 import (
+	"context"
 	"math/big"
 	"time"
 )
@@ -19,12 +20,30 @@ type Statistics struct {
 	StartedAt         time.Time
 	Status            string
 	MessagesInQueue   big.Int
+	InFlight          int
+	Counters          map[string]int64
 }
 
-// IProcessingStrategy processing strategy interface
+// ICountersProvider - component (e.g. processor) which exposes its own counters in strategy statistics
+type ICountersProvider interface {
+	GetCounters() map[string]int64
+}
+
+// IProcessingStrategy processing strategy interface.
+// Start blocks until strategy is stopped, jobs are cancelled when ctx is cancelled
 type IProcessingStrategy interface {
 	Configure(configuration map[string]interface{}, context *Context) error
-	Start() error
+	Start(ctx context.Context) error
 	Stop() error
 	GetStatistics() Statistics
 }
+
+// IQueueAware - strategy which exposes the queue it consumes, queue depth is shown in status
+type IQueueAware interface {
+	GetQueue() IConsumableQueue
+}
+
+// IInFlightAware - strategy which knows jobs being processed at the moment
+type IInFlightAware interface {
+	GetInFlight() []interface{}
+}
@@ -0,0 +1,49 @@
+package qp
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName - instrumentation name of qp spans
+const TracerName = "github.com/iVariable/qp"
+
+// tracePropagator - W3C trace context (traceparent and tracestate)
+var tracePropagator = propagation.TraceContext{}
+
+// Tracer returns tracer of the configured tracer provider (no-op if tracing is disabled)
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// ExtractTraceContext returns ctx with parent span taken from traceparent and tracestate attributes of the message
+func ExtractTraceContext(ctx context.Context, message IMessage) context.Context {
+	return tracePropagator.Extract(ctx, propagation.MapCarrier(message.GetAttributes()))
+}
+
+// TraceContextFields returns W3C trace context fields (traceparent, tracestate) of the span in ctx.
+// Processors pass them to the application (HTTP headers, environment variables, etc)
+func TraceContextFields(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// StartSpan starts span which is child of the span in parent. Returned ctx carries cancellation of ctx and the new span
+func StartSpan(ctx context.Context, parent context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(parent))
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan ends span, error is recorded as span status
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
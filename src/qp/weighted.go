@@ -0,0 +1,250 @@
+package qp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WeightedQueue - consumes several queues as one. Queues with ready messages are picked
+// by smooth weighted round-robin, so every queue gets its share and none of them is starved.
+// Ack, reject and delay are routed to the queue message came from
+type WeightedQueue struct {
+	queues   []*weightedSource
+	ready    chan bool
+	mutex    sync.Mutex
+	prefetch context.Context
+	cancel   context.CancelFunc
+	release  func(message IMessage)
+	counters map[string]int64
+}
+
+type weightedSource struct {
+	name    string
+	queue   IConsumableQueue
+	weight  int
+	current int
+	pending *weightedResult
+	taken   chan bool
+}
+
+type weightedResult struct {
+	message IMessage
+	err     error
+}
+
+// routedMessage - message which remembers its queue
+type routedMessage struct {
+	IMessage
+	queue     IConsumableQueue
+	queueName string
+}
+
+// NewWeightedQueue - constructor for WeightedQueue. Queues are consumed from the first Consume call
+func NewWeightedQueue(names []string, queues []IConsumableQueue, weights []int) *WeightedQueue {
+	q := &WeightedQueue{
+		ready:    make(chan bool, 1),
+		counters: make(map[string]int64),
+	}
+	for i, queue := range queues {
+		source := &weightedSource{
+			name:   names[i],
+			queue:  queue,
+			weight: weights[i],
+			taken:  make(chan bool, 1),
+		}
+		q.queues = append(q.queues, source)
+	}
+	return q
+}
+
+// prefetchMessages keeps one consumed message of the queue ready until ctx is cancelled
+func (q *WeightedQueue) prefetchMessages(ctx context.Context, source *weightedSource) {
+	for {
+		message, err := source.queue.Consume(ctx)
+
+		q.mutex.Lock()
+		if q.prefetch != ctx {
+			release := q.release
+			q.mutex.Unlock()
+			if err == nil && release != nil {
+				release(&routedMessage{IMessage: message, queue: source.queue, queueName: source.name})
+			}
+			return
+		}
+		source.pending = &weightedResult{message, err}
+		q.mutex.Unlock()
+
+		select {
+		case q.ready <- true:
+		default:
+		}
+
+		select {
+		case <-source.taken:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// StopPrefetch stops consuming of the queues. Prefetched messages (including ones consumed later)
+// are passed to release. Prefetching is started again by the next Consume call
+func (q *WeightedQueue) StopPrefetch(release func(message IMessage)) {
+	q.mutex.Lock()
+	if q.prefetch == nil {
+		q.mutex.Unlock()
+		return
+	}
+	q.cancel()
+	q.prefetch = nil
+	q.release = release
+
+	var prefetched []IMessage
+	for _, source := range q.queues {
+		if source.pending != nil && source.pending.err == nil {
+			prefetched = append(prefetched, &routedMessage{IMessage: source.pending.message, queue: source.queue, queueName: source.name})
+		}
+		source.pending = nil
+	}
+	q.mutex.Unlock()
+
+	for _, message := range prefetched {
+		release(message)
+	}
+}
+
+// pick returns queue with ready message according to weights
+func (q *WeightedQueue) pick() *weightedSource {
+	var selected *weightedSource
+	total := 0
+	for _, source := range q.queues {
+		if source.pending == nil {
+			continue
+		}
+		source.current += source.weight
+		total += source.weight
+		if selected == nil || source.current > selected.current {
+			selected = source
+		}
+	}
+	if selected != nil {
+		selected.current -= total
+	}
+	return selected
+}
+
+// GetName returns name of the queue
+func (q *WeightedQueue) GetName() string {
+	return "Weighted"
+}
+
+// Configure - queues are configured on their own
+func (q *WeightedQueue) Configure(configuration map[string]interface{}) error {
+	return nil
+}
+
+// Consume consumes a message from one of the queues
+func (q *WeightedQueue) Consume(ctx context.Context) (IMessage, error) {
+	for {
+		q.mutex.Lock()
+		if q.prefetch == nil {
+			// queues are consumed in background, their requests are reported to consume ctx reporter
+			q.prefetch, q.cancel = context.WithCancel(withPollReporterOf(context.Background(), ctx))
+			for _, source := range q.queues {
+				select {
+				case <-source.taken:
+				default:
+				}
+				go q.prefetchMessages(q.prefetch, source)
+			}
+		}
+		var result weightedResult
+		source := q.pick()
+		if source != nil {
+			result = *source.pending
+			source.pending = nil
+			q.counters["queue."+source.name]++
+		}
+		q.mutex.Unlock()
+
+		if source == nil {
+			select {
+			case <-q.ready:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		source.taken <- true
+		if result.err != nil {
+			return nil, result.err
+		}
+		return &routedMessage{IMessage: result.message, queue: source.queue, queueName: source.name}, nil
+	}
+}
+
+// SourceQueue returns name of the queue message consumed from WeightedQueue came from, empty for other messages
+func SourceQueue(message IMessage) string {
+	if routed, ok := message.(*routedMessage); ok {
+		return routed.queueName
+	}
+	return ""
+}
+
+// Ack acknowledges message in its queue
+func (q *WeightedQueue) Ack(ctx context.Context, message IMessage) error {
+	routed, ok := message.(*routedMessage)
+	if !ok {
+		return errors.New("Message was not consumed from WeightedQueue")
+	}
+	return routed.queue.Ack(ctx, routed.IMessage)
+}
+
+// Reject rejects message in its queue
+func (q *WeightedQueue) Reject(ctx context.Context, message IMessage) error {
+	routed, ok := message.(*routedMessage)
+	if !ok {
+		return errors.New("Message was not consumed from WeightedQueue")
+	}
+	return routed.queue.Reject(ctx, routed.IMessage)
+}
+
+// Delay delays message in its queue if the queue supports it
+func (q *WeightedQueue) Delay(ctx context.Context, message IMessage, delay time.Duration) error {
+	routed, ok := message.(*routedMessage)
+	if !ok {
+		return errors.New("Message was not consumed from WeightedQueue")
+	}
+	delayable, ok := routed.queue.(IDelayableQueue)
+	if !ok {
+		return ErrDelayNotSupported
+	}
+	return delayable.Delay(ctx, routed.IMessage, delay)
+}
+
+// GetNumberOfMessages returns total number of messages of all queues
+func (q *WeightedQueue) GetNumberOfMessages(ctx context.Context) (int, error) {
+	total := 0
+	for _, source := range q.queues {
+		count, err := source.queue.GetNumberOfMessages(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// GetCounters returns number of messages consumed from every queue
+func (q *WeightedQueue) GetCounters() map[string]int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	counters := make(map[string]int64, len(q.counters))
+	for name, value := range q.counters {
+		counters[name] = value
+	}
+	return counters
+}
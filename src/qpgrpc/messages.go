@@ -0,0 +1,189 @@
+package qpgrpc
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProcessMethod - full name of the Process method of Processor service (see processor.proto)
+const ProcessMethod = "/qp.Processor/Process"
+
+// Verdict actions, see processor.proto
+const (
+	ActionUnspecified = 0
+	ActionAck         = 1
+	ActionReject      = 2
+	ActionRetry       = 3
+)
+
+// Job - qp.Job message of processor.proto
+type Job struct {
+	ID         string
+	Body       []byte
+	Attributes map[string]string
+	Attempt    int32
+}
+
+// Verdict - qp.Verdict message of processor.proto
+type Verdict struct {
+	Action       int32
+	Reason       string
+	RetryAfterMs int64
+}
+
+// Marshal encodes Job into protobuf wire format
+func (j *Job) Marshal() []byte {
+	var b []byte
+	if j.ID != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, j.ID)
+	}
+	if len(j.Body) > 0 {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, j.Body)
+	}
+	for name, value := range j.Attributes {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, value)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	if j.Attempt != 0 {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(j.Attempt))
+	}
+	return b
+}
+
+// Unmarshal decodes Job from protobuf wire format
+func (j *Job) Unmarshal(b []byte) error {
+	return parseFields(b, func(number protowire.Number, wireType protowire.Type, value []byte, varint uint64) error {
+		switch {
+		case number == 1 && wireType == protowire.BytesType:
+			j.ID = string(value)
+		case number == 2 && wireType == protowire.BytesType:
+			j.Body = append([]byte(nil), value...)
+		case number == 3 && wireType == protowire.BytesType:
+			var name, attribute string
+			err := parseFields(value, func(number protowire.Number, wireType protowire.Type, value []byte, varint uint64) error {
+				switch {
+				case number == 1 && wireType == protowire.BytesType:
+					name = string(value)
+				case number == 2 && wireType == protowire.BytesType:
+					attribute = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if j.Attributes == nil {
+				j.Attributes = make(map[string]string)
+			}
+			j.Attributes[name] = attribute
+		case number == 4 && wireType == protowire.VarintType:
+			j.Attempt = int32(varint)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes Verdict into protobuf wire format
+func (v *Verdict) Marshal() []byte {
+	var b []byte
+	if v.Action != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.Action))
+	}
+	if v.Reason != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, v.Reason)
+	}
+	if v.RetryAfterMs != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.RetryAfterMs))
+	}
+	return b
+}
+
+// Unmarshal decodes Verdict from protobuf wire format
+func (v *Verdict) Unmarshal(b []byte) error {
+	return parseFields(b, func(number protowire.Number, wireType protowire.Type, value []byte, varint uint64) error {
+		switch {
+		case number == 1 && wireType == protowire.VarintType:
+			v.Action = int32(varint)
+		case number == 2 && wireType == protowire.BytesType:
+			v.Reason = string(value)
+		case number == 3 && wireType == protowire.VarintType:
+			v.RetryAfterMs = int64(varint)
+		}
+		return nil
+	})
+}
+
+// parseFields iterates over top-level fields of protobuf message. Unknown fields are skipped
+func parseFields(b []byte, field func(number protowire.Number, wireType protowire.Type, value []byte, varint uint64) error) error {
+	for len(b) > 0 {
+		number, wireType, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var value []byte
+		var varint uint64
+		switch wireType {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := field(number, wireType, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Codec - grpc codec for Job and Verdict messages. It is not registered, calls pass it with grpc.ForceCodec.
+// Named "proto" (content-subtype of requests), its wire format is compatible with generated protobuf code
+type Codec struct{}
+
+type message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+// Marshal implements encoding.Codec
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported message type %T", v)
+	}
+	return m.Marshal(), nil
+}
+
+// Unmarshal implements encoding.Codec
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return errors.New("Unsupported message type")
+	}
+	return m.Unmarshal(data)
+}
+
+// Name implements encoding.Codec
+func (Codec) Name() string {
+	return "proto"
+}
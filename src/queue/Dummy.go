@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
@@ -21,17 +22,26 @@ type dummyConfiguration struct {
 	RandomSleepDelay int
 }
 
+// Options returns options struct of the queue
+func (q *Dummy) Options() interface{} {
+	return &dummyConfiguration{}
+}
+
 // GetName returns queue name
 func (q *Dummy) GetName() string {
 	return "Dummy queue"
 }
 
 // Consume consumes a message
-func (q *Dummy) Consume() (qp.IMessage, error) {
+func (q *Dummy) Consume(ctx context.Context) (qp.IMessage, error) {
 	q.logger.Debug("Message consume")
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	time.Sleep(time.Duration(r.Intn(q.configuration.RandomSleepDelay)) * time.Millisecond) //TODO make configurable
+	select {
+	case <-time.After(time.Duration(r.Intn(q.configuration.RandomSleepDelay)) * time.Millisecond): //TODO make configurable
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
 	return &qp.Message{
 		ID:   time.Now(),
@@ -39,7 +49,7 @@ func (q *Dummy) Consume() (qp.IMessage, error) {
 }
 
 // Ack acknowledges a message
-func (q *Dummy) Ack(message qp.IMessage) error {
+func (q *Dummy) Ack(ctx context.Context, message qp.IMessage) error {
 	q.logger.WithField("message", message).Debug("Message acknowledged")
 	return nil
 }
@@ -51,7 +61,9 @@ func (q *Dummy) Configure(configuration map[string]interface{}) error {
 		"queue": "Dummy",
 	})
 	q.logger.Debug("Reading configuration")
-	utils.FillStruct(configuration, &q.configuration)
+	if err := utils.Decode(configuration, &q.configuration); err != nil {
+		return err
+	}
 	if q.configuration.RandomSleepDelay < 0 {
 		return errors.New("RandomSleepDelay should be >= 0")
 	}
@@ -60,12 +72,12 @@ func (q *Dummy) Configure(configuration map[string]interface{}) error {
 }
 
 // Reject reject a message
-func (q *Dummy) Reject(message qp.IMessage) error {
+func (q *Dummy) Reject(ctx context.Context, message qp.IMessage) error {
 	q.logger.WithField("message", message).Debug("Message rejected")
 	return nil
 }
 
 // GetNumberOfMessages returns number of messages
-func (q *Dummy) GetNumberOfMessages() (int, error) {
+func (q *Dummy) GetNumberOfMessages(ctx context.Context) (int, error) {
 	return 9999, nil
 }
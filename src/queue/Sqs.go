@@ -4,14 +4,21 @@ import (
 	"github.com/iVariable/qp/src/qp"
 	"github.com/iVariable/qp/src/utils"
 
+	"context"
+	"encoding/json"
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"strconv"
+	"time"
 )
 
+// sqsMaxVisibilityTimeout - SQS limit of message visibility timeout
+const sqsMaxVisibilityTimeout = 12 * time.Hour
+
 // Sqs - AWS SQS implementation
 type Sqs struct {
 	configuration sqsConfiguration
@@ -21,10 +28,15 @@ type Sqs struct {
 }
 
 type sqsConfiguration struct {
-	QueueName       string
-	WaitTimeSeconds int
-	AwsRegion       string
-	AwsProfile      string
+	QueueName       string `required:"true"`
+	WaitTimeSeconds int    `default:"20"`
+	AwsRegion       string `required:"true"`
+	AwsProfile      string `required:"true"`
+}
+
+// Options returns options struct of the queue
+func (q *Sqs) Options() interface{} {
+	return &sqsConfiguration{}
 }
 
 // Configure configure queue
@@ -34,8 +46,9 @@ func (q *Sqs) Configure(configuration map[string]interface{}) error {
 		"queue": "Sqs",
 	})
 	q.logger.Debug("Reading configuration")
-	q.configuration.WaitTimeSeconds = 20 //Defaults
-	utils.FillStruct(configuration, &q.configuration)
+	if err := utils.Decode(configuration, &q.configuration); err != nil {
+		return err
+	}
 
 	if q.configuration.AwsProfile == "" {
 		return errors.New("You need to provide AwsProfile for Sqs queue")
@@ -74,40 +87,63 @@ func (q *Sqs) GetName() string {
 }
 
 // Consume consume a message from the queue
-func (q *Sqs) Consume() (qp.IMessage, error) {
+func (q *Sqs) Consume(ctx context.Context) (qp.IMessage, error) {
 	q.logger.Debug("Message consume")
 	for {
 		params := &sqs.ReceiveMessageInput{
 			QueueUrl:            aws.String(*q.queueURL),
 			MaxNumberOfMessages: aws.Int64(1),
 			WaitTimeSeconds:     aws.Int64(int64(q.configuration.WaitTimeSeconds)),
+			MessageAttributeNames: []*string{
+				aws.String("All"),
+			},
+			AttributeNames: []*string{
+				aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
+			},
 		}
 
-		resp, err := q.queue.ReceiveMessage(params)
+		done := qp.ReportPoll(ctx, time.Duration(q.configuration.WaitTimeSeconds)*time.Second)
+		resp, err := q.queue.ReceiveMessageWithContext(ctx, params)
+		done()
 
 		if err != nil {
 			return nil, err
 		}
 
 		if len(resp.Messages) != 0 {
+			attributes := make(map[string]string)
+			for name, value := range resp.Messages[0].MessageAttributes {
+				if value.StringValue != nil {
+					attributes[name] = *value.StringValue
+				}
+			}
+			var enqueuedAt time.Time
+			if sentTimestamp, ok := resp.Messages[0].Attributes[sqs.MessageSystemAttributeNameSentTimestamp]; ok {
+				if milliseconds, err := strconv.ParseInt(*sentTimestamp, 10, 64); err == nil {
+					enqueuedAt = time.Unix(0, milliseconds*int64(time.Millisecond))
+				}
+			}
 			return &qp.Message{
-				ID:   *resp.Messages[0].ReceiptHandle,
-				Body: *resp.Messages[0].Body,
-				Raw:  resp.GoString(),
+				ID:         *resp.Messages[0].ReceiptHandle,
+				Body:       *resp.Messages[0].Body,
+				Raw:        resp.GoString(),
+				Attributes: attributes,
+				EnqueuedAt: enqueuedAt,
+				MessageID:  aws.StringValue(resp.Messages[0].MessageId),
 			}, nil
 		}
 	}
 }
 
 // Ack acknowledge a message
-func (q *Sqs) Ack(message qp.IMessage) error {
+func (q *Sqs) Ack(ctx context.Context, message qp.IMessage) error {
 	q.logger.WithField("message", message).Debug("Message acknowledged")
 	params := &sqs.DeleteMessageInput{
 		QueueUrl:      aws.String(*q.queueURL),
 		ReceiptHandle: aws.String((message.GetID()).(string)),
 	}
 
-	_, err := q.queue.DeleteMessage(params)
+	_, err := q.queue.DeleteMessageWithContext(ctx, params)
 
 	if err != nil {
 		return err
@@ -117,7 +153,7 @@ func (q *Sqs) Ack(message qp.IMessage) error {
 }
 
 // Reject reject a message
-func (q *Sqs) Reject(message qp.IMessage) error {
+func (q *Sqs) Reject(ctx context.Context, message qp.IMessage) error {
 	q.logger.WithField("message", message).Debug("Message rejected")
 	// Do nothing. Aws SQS will take care of not acknowledged messages
 	// and will put them into dead letter queue for us
@@ -125,7 +161,73 @@ func (q *Sqs) Reject(message qp.IMessage) error {
 	return nil
 }
 
-// GetNumberOfMessages returns the number of messages
-func (q *Sqs) GetNumberOfMessages() (int, error) {
-	return 9999999, nil
+// Delay hides message for delay by extending its visibility timeout (12 hours at most)
+func (q *Sqs) Delay(ctx context.Context, message qp.IMessage, delay time.Duration) error {
+	q.logger.WithFields(log.Fields{
+		"message": message,
+		"delay":   delay,
+	}).Debug("Message delayed")
+	if delay > sqsMaxVisibilityTimeout {
+		delay = sqsMaxVisibilityTimeout
+	}
+	params := &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(*q.queueURL),
+		ReceiptHandle:     aws.String((message.GetID()).(string)),
+		VisibilityTimeout: aws.Int64(int64((delay + time.Second - 1) / time.Second)),
+	}
+
+	_, err := q.queue.ChangeMessageVisibilityWithContext(ctx, params)
+
+	return err
+}
+
+// Publish sends a message to the queue. Bodies other than strings are sent as JSON
+func (q *Sqs) Publish(ctx context.Context, message qp.IMessage) error {
+	q.logger.WithField("message", message).Debug("Message publish")
+	var body string
+	switch value := message.GetBody().(type) {
+	case string:
+		body = value
+	case []byte:
+		body = string(value)
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		body = string(encoded)
+	}
+
+	params := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(*q.queueURL),
+		MessageBody:       aws.String(body),
+		MessageAttributes: make(map[string]*sqs.MessageAttributeValue),
+	}
+	for name, value := range message.GetAttributes() {
+		if value == "" {
+			continue // SQS does not accept empty attribute values
+		}
+		params.MessageAttributes[name] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	_, err := q.queue.SendMessageWithContext(ctx, params)
+
+	return err
+}
+
+// GetNumberOfMessages returns approximate number of messages available for consume
+func (q *Sqs) GetNumberOfMessages(ctx context.Context) (int, error) {
+	resp, err := q.queue.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: q.queueURL,
+		AttributeNames: []*string{
+			aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(aws.StringValue(resp.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]))
 }
@@ -1,7 +1,9 @@
 package queue
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/iVariable/qp/src/qp"
 	"github.com/iVariable/qp/src/utils"
 	"sync"
@@ -18,11 +20,17 @@ type Tail struct {
 	messages      chan *tail.Line
 	once          sync.Once
 	startTailing  func()
+	tailError     error
 	logger        *log.Entry
 }
 
 type tailConfiguration struct {
-	Path string
+	Path string `required:"true"`
+}
+
+// Options returns options struct of the queue
+func (q *Tail) Options() interface{} {
+	return &tailConfiguration{}
 }
 
 // Configure configure queue
@@ -32,15 +40,18 @@ func (q *Tail) Configure(configuration map[string]interface{}) error {
 		"queue": "Tail",
 	})
 	q.logger.Debug("Reading configuration")
-	utils.FillStruct(configuration, &q.configuration)
+	if err := utils.Decode(configuration, &q.configuration); err != nil {
+		return err
+	}
 
 	q.messages = make(chan *tail.Line)
 
 	q.startTailing = func() {
 		t, err := tail.TailFile(q.configuration.Path, tail.Config{Follow: true})
 		if err != nil {
-			q.logger.WithField("file", q.configuration.Path).Fatal("Failed to tail file")
-			utils.Quitf(utils.ExitCodeRuntimeError, "Failed to tail file %s", q.configuration.Path)
+			q.logger.WithField("file", q.configuration.Path).Error("Failed to tail file")
+			q.tailError = fmt.Errorf("Failed to tail file %s: %s", q.configuration.Path, err.Error())
+			return
 		}
 		q.t = t
 
@@ -55,34 +66,50 @@ func (q *Tail) Configure(configuration map[string]interface{}) error {
 	return nil
 }
 
+// Close stops tailing of the file
+func (q *Tail) Close() error {
+	if q.t == nil {
+		return nil
+	}
+	return q.t.Stop()
+}
+
 // GetName returns queue name
 func (q *Tail) GetName() string {
 	return "Tail"
 }
 
 // Consume consumes a message from the queue
-func (q *Tail) Consume() (qp.IMessage, error) {
+func (q *Tail) Consume(ctx context.Context) (qp.IMessage, error) {
 	q.once.Do(q.startTailing)
+	if q.tailError != nil {
+		return nil, q.tailError
+	}
 	q.logger.Debug("Message consume")
 
-	line := <-q.messages
+	var line *tail.Line
+	select {
+	case line = <-q.messages:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
 	return &qp.Message{ID: line.Time.String(), Body: line.Text}, nil
 }
 
 // Ack acknowledges a message from the queue
-func (q *Tail) Ack(message qp.IMessage) error {
+func (q *Tail) Ack(ctx context.Context, message qp.IMessage) error {
 	q.logger.WithField("message", message).Debug("Message acknowledged")
 	return nil
 }
 
 // Reject rejects a message
-func (q *Tail) Reject(message qp.IMessage) error {
+func (q *Tail) Reject(ctx context.Context, message qp.IMessage) error {
 	q.logger.WithField("message", message).Debug("Message rejected")
 	return errors.New("Tail queue does NOT support Reject() method")
 }
 
 // GetNumberOfMessages return number of messages in the queue
-func (q *Tail) GetNumberOfMessages() (int, error) {
+func (q *Tail) GetNumberOfMessages(ctx context.Context) (int, error) {
 	return 9999999, nil
 }
@@ -1,10 +1,14 @@
 package resources
 
 import (
+	"fmt"
+	"github.com/iVariable/qp/src/codec"
+	"github.com/iVariable/qp/src/middleware"
 	"github.com/iVariable/qp/src/processor"
 	"github.com/iVariable/qp/src/qp"
 	"github.com/iVariable/qp/src/queue"
 	"github.com/iVariable/qp/src/strategy"
+	"sync"
 )
 
 var (
@@ -16,33 +20,157 @@ var (
 
 	// AvailableProcessors list of configured ready-to-use processors
 	AvailableProcessors = make(map[string]func() qp.IProcessor)
+
+	// AvailableMiddleware list of configured ready-to-use processing middleware
+	AvailableMiddleware = make(map[string]func() qp.IMiddleware)
+
+	// AvailableCodecs list of configured ready-to-use message body codecs
+	AvailableCodecs = make(map[string]func() qp.ICodec)
+
+	registryMutex sync.Mutex
 )
 
+// RegisterQueue makes queue type available for configuration.
+// Panics if queue type with the same name is already registered
+func RegisterQueue(typeName string, factory func() qp.IConsumableQueue) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := AvailableQueues[typeName]; ok {
+		panic(fmt.Sprintf("Queue type %s is already registered", typeName))
+	}
+	AvailableQueues[typeName] = factory
+}
+
+// RegisterStrategy makes processing strategy type available for configuration.
+// Panics if strategy type with the same name is already registered
+func RegisterStrategy(typeName string, factory func() qp.IProcessingStrategy) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := AvailableStrategies[typeName]; ok {
+		panic(fmt.Sprintf("Strategy type %s is already registered", typeName))
+	}
+	AvailableStrategies[typeName] = factory
+}
+
+// RegisterProcessor makes processor type available for configuration.
+// Panics if processor type with the same name is already registered
+func RegisterProcessor(typeName string, factory func() qp.IProcessor) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := AvailableProcessors[typeName]; ok {
+		panic(fmt.Sprintf("Processor type %s is already registered", typeName))
+	}
+	AvailableProcessors[typeName] = factory
+}
+
+// RegisterMiddleware makes middleware type available for configuration.
+// Panics if middleware type with the same name is already registered
+func RegisterMiddleware(typeName string, factory func() qp.IMiddleware) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := AvailableMiddleware[typeName]; ok {
+		panic(fmt.Sprintf("Middleware type %s is already registered", typeName))
+	}
+	AvailableMiddleware[typeName] = factory
+}
+
+// RegisterCodec makes message body codec type available for configuration.
+// Panics if codec type with the same name is already registered
+func RegisterCodec(typeName string, factory func() qp.ICodec) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := AvailableCodecs[typeName]; ok {
+		panic(fmt.Sprintf("Codec type %s is already registered", typeName))
+	}
+	AvailableCodecs[typeName] = factory
+}
+
 func init() {
 	//Queues
-	AvailableQueues["Dummy"] = func() qp.IConsumableQueue {
+	RegisterQueue("Dummy", func() qp.IConsumableQueue {
 		return &queue.Dummy{}
-	}
-	AvailableQueues["Tail"] = func() qp.IConsumableQueue {
+	})
+	RegisterQueue("Tail", func() qp.IConsumableQueue {
 		return &queue.Tail{}
-	}
-	AvailableQueues["Sqs"] = func() qp.IConsumableQueue {
+	})
+	RegisterQueue("Sqs", func() qp.IConsumableQueue {
 		return &queue.Sqs{}
-	}
+	})
 
 	//Strategies
-	AvailableStrategies["ParallelProcessing"] = func() qp.IProcessingStrategy {
+	RegisterStrategy("ParallelProcessing", func() qp.IProcessingStrategy {
 		return &strategy.ParallelProcessing{}
-	}
+	})
+	RegisterStrategy("WeightedProcessing", func() qp.IProcessingStrategy {
+		return &strategy.WeightedProcessing{}
+	})
 
 	//Processors
-	AvailableProcessors["Stdout"] = func() qp.IProcessor {
+	RegisterProcessor("Stdout", func() qp.IProcessor {
 		return &processor.Stdout{}
-	}
-	AvailableProcessors["Shell"] = func() qp.IProcessor {
+	})
+	RegisterProcessor("Shell", func() qp.IProcessor {
 		return &processor.Shell{}
-	}
-	AvailableProcessors["HTTPProxy"] = func() qp.IProcessor {
+	})
+	RegisterProcessor("HTTPProxy", func() qp.IProcessor {
 		return &processor.HTTPProxy{}
-	}
+	})
+	RegisterProcessor("ShellWorker", func() qp.IProcessor {
+		return &processor.ShellWorker{}
+	})
+	RegisterProcessor("FastCGI", func() qp.IProcessor {
+		return &processor.FastCGI{}
+	})
+	RegisterProcessor("GRPC", func() qp.IProcessor {
+		return &processor.GRPC{}
+	})
+	RegisterProcessor("Pipeline", func() qp.IProcessor {
+		return &processor.Pipeline{}
+	})
+	RegisterProcessor("FanOut", func() qp.IProcessor {
+		return &processor.FanOut{}
+	})
+	RegisterProcessor("Router", func() qp.IProcessor {
+		return &processor.Router{}
+	})
+	RegisterProcessor("Transform", func() qp.IProcessor {
+		return &processor.Transform{}
+	})
+	RegisterProcessor("Validate", func() qp.IProcessor {
+		return &processor.Validate{}
+	})
+
+	//Middleware
+	RegisterMiddleware("Logging", func() qp.IMiddleware {
+		return &middleware.Logging{}
+	})
+	RegisterMiddleware("Timing", func() qp.IMiddleware {
+		return &middleware.Timing{}
+	})
+	RegisterMiddleware("Retry", func() qp.IMiddleware {
+		return &middleware.Retry{}
+	})
+	RegisterMiddleware("Validate", func() qp.IMiddleware {
+		return &middleware.Validate{}
+	})
+
+	//Codecs
+	RegisterCodec("Base64", func() qp.ICodec {
+		return &codec.Base64{}
+	})
+	RegisterCodec("Gzip", func() qp.ICodec {
+		return &codec.Gzip{}
+	})
+	RegisterCodec("Zstd", func() qp.ICodec {
+		return &codec.Zstd{}
+	})
+	RegisterCodec("JSON", func() qp.ICodec {
+		return &codec.JSON{}
+	})
+	RegisterCodec("Msgpack", func() qp.ICodec {
+		return &codec.Msgpack{}
+	})
+	RegisterCodec("Protobuf", func() qp.ICodec {
+		return &codec.Protobuf{}
+	})
 }
@@ -1,12 +1,20 @@
 package strategy
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/dedup"
+	"github.com/iVariable/qp/src/delay"
 	"github.com/iVariable/qp/src/qp"
 	"github.com/iVariable/qp/src/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"math/big"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,102 +25,246 @@ const (
 	OnProcessingErrorIgnore = "ignore"
 )
 
+// releaseTimeout - time given to return job to the queue. Jobs are released on stop, when processing context
+// may be already cancelled
+const releaseTimeout = 5 * time.Second
+
 type (
 	// ParallelProcessing - processing strategy
 	ParallelProcessing struct {
-		configuration parallelProcessingConfiguration
-		queue         qp.IConsumableQueue
-		processor     qp.IProcessor
-		process       bool
-		logger        *log.Entry
-		stop          chan bool
-		wait          sync.WaitGroup
-		jobs          chan *qp.SimpleJob
-		startedAt     time.Time
+		configuration  parallelProcessingConfiguration
+		queue          qp.IConsumableQueue
+		processor      qp.IProcessor
+		batchProcessor qp.IBatchProcessor
+		process        bool
+		logger         *log.Entry
+		stop           chan bool
+		wait           sync.WaitGroup
+		jobs           chan *qp.SimpleJob
+		batches        chan []*qp.SimpleJob
+		startedAt      time.Time
+		deduplicator   *dedup.Deduplicator
+		duplicates     int64
+		scheduler      *delay.Scheduler
+		timers         *delay.Timers
+		delayed        int64
+		stopping       int32
+		inFlight       map[*qp.SimpleJob]bool
+		inFlightMutex  sync.Mutex
+		ctx            context.Context
+		cancelConsume  context.CancelFunc
+		state          sync.Mutex
+		stopRequested  bool
+		consumeState   qp.ConsumeState
+		consumeMutex   sync.Mutex
+		polls          map[int64]consumePoll
+		pollID         int64
+		processed      int64
+		failed         int64
 	}
 
 	parallelProcessingConfiguration struct {
 		Name                string
 		MaxThreads          int
 		ProcessorThroughput int
-		Queue               string
-		Processor           string
+		Queue               string `ref:"queue"`
+		Processor           string `ref:"processor"`
 		OnProcessingError   string
+		MaxRetries          int
+		RetryDelay          int
+		Deduplication       *dedup.Configuration
+		BatchSize           int
+		BatchTimeout        int `default:"1000"`
+		NotBeforeAttribute  string
+		NotBeforeField      string
+		ProcessingDelay     int
+		MaxHeld             int `default:"1000"`
+		JobTimeout          int
 	}
 
 	consumeResult struct {
-		message qp.IMessage
-		err     error
+		message   qp.IMessage
+		err       error
+		startedAt time.Time
+	}
+
+	// consumePoll - outstanding request of consume to the queue, see qp.ReportPoll
+	consumePoll struct {
+		startedAt time.Time
+		wait      time.Duration
 	}
 )
 
+// Options returns options struct of the strategy
+func (p *ParallelProcessing) Options() interface{} {
+	return &parallelProcessingConfiguration{}
+}
+
+// Validate checks values of the options
+func (c parallelProcessingConfiguration) Validate() error {
+	errs := &utils.DecodeError{}
+	switch c.OnProcessingError {
+	case OnProcessingErrorIgnore, OnProcessingErrorWarning, OnProcessingErrorPanic:
+	default:
+		errs.Add("OnProcessingError", "one of %q, %q or %q expected, %q given",
+			OnProcessingErrorPanic, OnProcessingErrorWarning, OnProcessingErrorIgnore, c.OnProcessingError)
+	}
+	if c.MaxThreads <= 0 {
+		errs.Add("MaxThreads", "should be > 0")
+	}
+	if c.MaxRetries < 0 {
+		errs.Add("MaxRetries", "should be >= 0")
+	}
+	if c.RetryDelay < 0 {
+		errs.Add("RetryDelay", "should be >= 0")
+	}
+	if c.MaxHeld <= 0 {
+		errs.Add("MaxHeld", "should be > 0")
+	}
+	if c.JobTimeout < 0 {
+		errs.Add("JobTimeout", "should be >= 0")
+	}
+	if c.BatchSize > 1 && c.BatchTimeout <= 0 {
+		errs.Add("BatchTimeout", "should be > 0")
+	}
+	return errs.OrNil()
+}
+
 // Configure configures strategy
 func (p *ParallelProcessing) Configure(configuration map[string]interface{}, context *qp.Context) error {
+	return p.configure(configuration, context, "ParallelProcessing", nil)
+}
+
+// configure configures strategy of strategyType. Queue is taken from Queue option if not provided
+func (p *ParallelProcessing) configure(configuration map[string]interface{}, context *qp.Context, strategyType string, queue qp.IConsumableQueue) error {
 	log.WithFields(log.Fields{
-		"strategy": "ParallelProcessing",
+		"strategy": strategyType,
 	}).Debug("Reading configuration")
 
-	utils.FillStruct(configuration, &p.configuration)
+	if err := utils.Decode(configuration, &p.configuration); err != nil {
+		return err
+	}
 	p.logger = log.WithFields(log.Fields{
 		"type":     "strategy",
-		"strategy": "ParallelProcessing",
+		"strategy": strategyType,
 		"name":     p.configuration.Name,
 	})
 
-	switch p.configuration.OnProcessingError {
-	case OnProcessingErrorIgnore:
-	case OnProcessingErrorWarning:
-	case OnProcessingErrorPanic:
-	default:
-		panic("Unknown value set for OnProcessingError")
-	}
-
-	if p.configuration.MaxThreads <= 0 {
-		panic("MaxThreads option for ParallelProcessing strategy should be > 0") //PROBABLY SHOULD BE ERROR
+	if err := p.configuration.Validate(); err != nil {
+		return err
 	}
 
-	if queue, ok := context.AvailableQueues[p.configuration.Queue]; !ok {
-		panic("Unknown Queue requested")
+	if queue != nil {
+		p.queue = queue
+	} else if queue, ok := context.AvailableQueues[p.configuration.Queue]; !ok {
+		return fmt.Errorf("Unknown Queue [%s] requested", p.configuration.Queue)
 	} else {
 		p.queue = *queue
 	}
 
 	if processor, ok := context.AvailableProcessors[p.configuration.Processor]; !ok {
-		panic("Unknown Queue requested")
+		return fmt.Errorf("Unknown Processor [%s] requested", p.configuration.Processor)
 	} else {
 		p.processor = *processor
 	}
 
-	p.stop = make(chan bool)
+	if p.configuration.BatchSize > 1 {
+		batchProcessor, ok := p.processor.(qp.IBatchProcessor)
+		if !ok {
+			return errors.New("Processor " + p.configuration.Processor + " does not support batches")
+		}
+		if checker, ok := batchProcessor.(qp.IBatchSupportChecker); ok {
+			if err := checker.CheckBatchSupport(); err != nil {
+				return errors.New("Processor " + p.configuration.Processor + " does not support batches: " + err.Error())
+			}
+		}
+		p.batchProcessor = batchProcessor
+	}
+
+	scheduler, err := delay.NewScheduler(delay.Configuration{
+		NotBeforeAttribute: p.configuration.NotBeforeAttribute,
+		NotBeforeField:     p.configuration.NotBeforeField,
+		ProcessingDelay:    p.configuration.ProcessingDelay,
+	})
+	if err != nil {
+		return err
+	}
+	if scheduler.IsEnabled() {
+		p.scheduler = scheduler
+	}
+
+	// Store of previous configuration is closed when strategy is configured again
+	// (bolt database can't be opened twice)
+	if p.deduplicator != nil {
+		p.deduplicator.Close()
+		p.deduplicator = nil
+	}
+	if p.configuration.Deduplication != nil {
+		p.deduplicator = &dedup.Deduplicator{}
+		if err := p.deduplicator.Configure(*p.configuration.Deduplication, p.logger); err != nil {
+			return errors.New("Deduplication: " + err.Error())
+		}
+	}
 
 	p.logger.WithField("configuration", p.configuration).Info("Configuration loaded")
 
 	return nil
 }
 
-// Start starts processing queue
-func (p *ParallelProcessing) Start() error {
+// Start starts processing queue. Jobs are processed within ctx, cancelled ctx interrupts running jobs.
+// Stopped strategy can be started again. If Stop was called before Start, Start returns right away
+func (p *ParallelProcessing) Start(ctx context.Context) error {
 	p.logger.Info("Start processing")
+	p.state.Lock()
 	if p.process {
+		p.state.Unlock()
 		p.logger.Error("Attempt to start already running strategy")
 		return errors.New("This strategy is already running! You need to Stop() it before calling Start again")
 	}
+	if p.stopRequested {
+		p.stopRequested = false
+		p.state.Unlock()
+		p.logger.Info("Strategy was stopped before start")
+		return nil
+	}
 	p.startedAt = time.Now()
 	p.process = true
+	atomic.StoreInt32(&p.stopping, 0)
+	p.inFlightMutex.Lock()
+	p.inFlight = make(map[*qp.SimpleJob]bool)
+	p.inFlightMutex.Unlock()
+	p.stop = make(chan bool)
+	p.ctx = ctx
+	consumeCtx, cancelConsume := context.WithCancel(qp.WithPollReporter(ctx, p.recordPoll))
+	p.cancelConsume = cancelConsume
 
 	p.jobs = make(chan *qp.SimpleJob, p.configuration.MaxThreads)
+	var dueJobs <-chan *qp.SimpleJob
+	if p.scheduler != nil {
+		p.timers = delay.NewTimers()
+		dueJobs = p.timers.Due()
+	}
+	if p.batchProcessor != nil {
+		p.batches = make(chan []*qp.SimpleJob, p.configuration.MaxThreads)
+		go p.collectBatches()
+	}
+	p.wait.Add(1)
+	p.state.Unlock()
 
 	//Actual consumer
 	go func() {
 		p.logger.Debug("Start consuming messages")
 		messages := make(chan *consumeResult)
 		consume := func() {
-			message, err := p.queue.Consume()
-			messages <- &consumeResult{message, err}
+			startedAt := time.Now()
+			message, err := p.queue.Consume(consumeCtx)
+			messages <- &consumeResult{message, err, startedAt}
 		}
 
 		var message *consumeResult
 
+		// consuming pauses while MaxHeld jobs are held locally, it is resumed when held jobs are due
+		consuming := true
 		go consume()
 
 		prevSecond := time.Now().Second()
@@ -130,43 +282,91 @@ func (p *ParallelProcessing) Start() error {
 				}
 			}
 
+			var job *qp.SimpleJob
 			select {
 			case <-p.stop:
-				close(p.jobs)
-				p.logger.Info("Recieved stop signal. Stopped messages consuming")
+				if !consuming {
+					messages = nil // consuming is paused
+				}
+				p.drain(messages, nil)
 				return
+			case job = <-dueJobs:
+				p.logger.WithField("message", job.GetMessage()).Debug("Held job is due")
 			case message = <-messages:
+				consuming = false
 				messagesProcessed++
-				if message.err != nil {
+				if message.err != nil && consumeCtx.Err() != nil {
+					<-p.stop // consuming was cancelled, nothing to drain
+					p.drain(nil, nil)
+					return
+				} else if message.err != nil {
+					p.recordConsume(message.err)
+					p.traceConsume(nil, message)
 					p.logger.WithField("error", message.err.Error()).Error("Error on message consume")
 				} else {
-					job := qp.NewSimpleJob(p.queue, message.message)
+					p.recordConsume(nil)
+					job = qp.NewSimpleJob(p.queue, message.message)
+					job.SetContext(p.ctx)
+					p.traceConsume(job, message)
 					p.logger.WithField("message", message.message).Debug("Job created")
-					p.jobs <- job
+					if p.hold(job) {
+						job = nil
+					}
+				}
+			}
+
+			if job != nil {
+				select {
+				case p.jobs <- job:
+				case <-p.stop:
+					if !consuming {
+						messages = nil // next consume was not started yet
+					}
+					p.drain(messages, job)
+					return
 				}
+			}
+			if !consuming && !p.isHoldingMax() {
+				consuming = true
 				go consume()
 			}
 		}
 	}()
 
 	process := func(id int, decreaseWaitGroup bool) {
-		logger := p.logger.WithField("worker", id)
+		logger := p.logger.WithField(qp.LogFieldWorker, id)
 		logger.Debug("Start worker thread")
 		p.wait.Add(1)
 		if decreaseWaitGroup {
 			p.wait.Done()
 		}
-		for job := range p.jobs {
-			logger.Debug("Recieved job")
-			if err := p.processor.Process(job); err != nil {
-				switch p.configuration.OnProcessingError {
-				case OnProcessingErrorIgnore:
-				case OnProcessingErrorWarning:
-					logger.WithField("error", err.Error()).Warn("Error on job processing")
-				case OnProcessingErrorPanic:
-					logger.WithField("error", err.Error()).Fatal("Error on job processing")
-					panic("Error while processing: " + err.Error())
+		if p.batchProcessor != nil {
+			for batch := range p.batches {
+				logger.WithField("jobs", len(batch)).Debug("Recieved batch")
+				if p.isStopping() {
+					for _, job := range batch {
+						p.release(job, logger)
+					}
+					continue
+				}
+				p.track(batch...)
+				err := p.processBatch(batch, logger)
+				p.count(err, batch...)
+				p.handleError(err, logger)
+				p.untrack(batch...)
+			}
+		} else {
+			for job := range p.jobs {
+				logger.Debug("Recieved job")
+				if p.isStopping() {
+					p.release(job, logger)
+					continue
 				}
+				p.track(job)
+				err := p.processJob(job, logger)
+				p.count(err, job)
+				p.handleError(err, logger)
+				p.untrack(job)
 			}
 		}
 		logger.Debug("Worker thread finished")
@@ -174,7 +374,6 @@ func (p *ParallelProcessing) Start() error {
 	}
 
 	p.logger.Debug("Launching workers")
-	p.wait.Add(1)
 	for i := 1; i <= p.configuration.MaxThreads; i++ {
 		go process(i, i == 1)
 	}
@@ -184,20 +383,665 @@ func (p *ParallelProcessing) Start() error {
 	return nil
 }
 
+// isHoldingMax returns true if MaxHeld jobs are held in local timers
+func (p *ParallelProcessing) isHoldingMax() bool {
+	return p.timers != nil && p.timers.Len() >= p.configuration.MaxHeld
+}
+
+// hold delays job which is not due yet: in the queue if it supports delays, otherwise in local timers.
+// Message which the queue failed to delay is left in the queue, it is consumed again after visibility timeout.
+// Returns false if job should be processed right away
+func (p *ParallelProcessing) hold(job *qp.SimpleJob) bool {
+	if p.scheduler == nil {
+		return false
+	}
+
+	now := time.Now()
+	dueAt, err := p.scheduler.DueAt(job.GetMessage(), now)
+	if err != nil {
+		p.jobLogger(job, p.logger).WithField("error", err).Warn("Can't calculate job due time. Job is processed")
+		return false
+	}
+	if !dueAt.After(now) {
+		return false
+	}
+
+	if delayable, ok := p.queue.(qp.IDelayableQueue); ok {
+		err := delayable.Delay(p.ctx, job.GetMessage(), dueAt.Sub(now))
+		if err == nil {
+			atomic.AddInt64(&p.delayed, 1)
+			p.jobLogger(job, p.logger).WithField("dueAt", dueAt).Debug("Job delayed in queue")
+			return true
+		}
+		if err != qp.ErrDelayNotSupported {
+			// holding it locally would duplicate it: queue redelivers the message after visibility timeout
+			p.jobLogger(job, p.logger).WithField("error", err).Warn("Can't delay message in queue. It is left in the queue")
+			return true
+		}
+	}
+
+	p.timers.Hold(job, dueAt)
+	p.jobLogger(job, p.logger).WithField("dueAt", dueAt).Debug("Job held")
+	return true
+}
+
+// drain stops consuming on stop signal. Jobs which were consumed but not started are released to the queue.
+// Pending consume result is awaited from messages if provided
+func (p *ParallelProcessing) drain(messages chan *consumeResult, job *qp.SimpleJob) {
+	p.logger.Info("Recieved stop signal. Stopped messages consuming")
+
+	if job != nil {
+		p.release(job, p.logger)
+	}
+	for drained := false; !drained; {
+		select {
+		case job := <-p.jobs:
+			p.release(job, p.logger)
+		default:
+			drained = true
+		}
+	}
+	close(p.jobs)
+
+	if prefetching, ok := p.queue.(qp.IPrefetchingQueue); ok {
+		prefetching.StopPrefetch(func(message qp.IMessage) {
+			p.release(qp.NewSimpleJob(p.queue, message), p.logger)
+		})
+	}
+	if messages != nil {
+		go func() {
+			// message consumed after stop was never started
+			if message := <-messages; message.err == nil {
+				p.release(qp.NewSimpleJob(p.queue, message.message), p.logger)
+			}
+		}()
+	}
+	if p.timers != nil {
+		for _, job := range p.timers.Stop() {
+			p.release(job, p.logger)
+		}
+	}
+}
+
+// release returns job which was not started to the queue (visibility 0 for SQS) within releaseTimeout.
+// Jobs which can't be returned are logged as abandoned
+func (p *ParallelProcessing) release(job *qp.SimpleJob, logger *log.Entry) {
+	if delayable, ok := p.queue.(qp.IDelayableQueue); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		err := delayable.Delay(ctx, job.GetMessage(), 0)
+		cancel()
+		if err == nil {
+			p.jobLogger(job, logger).Info("Job released to the queue")
+			return
+		}
+		if err != qp.ErrDelayNotSupported {
+			p.jobLogger(job, logger).WithField("error", err).Error("Error on job release")
+		}
+	}
+	p.jobLogger(job, logger).Warn("Job abandoned")
+}
+
+func (p *ParallelProcessing) isStopping() bool {
+	return atomic.LoadInt32(&p.stopping) == 1
+}
+
+func (p *ParallelProcessing) track(jobs ...*qp.SimpleJob) {
+	p.inFlightMutex.Lock()
+	for _, job := range jobs {
+		p.inFlight[job] = true
+	}
+	p.inFlightMutex.Unlock()
+}
+
+func (p *ParallelProcessing) untrack(jobs ...*qp.SimpleJob) {
+	p.inFlightMutex.Lock()
+	for _, job := range jobs {
+		delete(p.inFlight, job)
+	}
+	p.inFlightMutex.Unlock()
+}
+
+// GetInFlight returns message IDs of jobs being processed
+func (p *ParallelProcessing) GetInFlight() []interface{} {
+	p.inFlightMutex.Lock()
+	defer p.inFlightMutex.Unlock()
+	ids := make([]interface{}, 0, len(p.inFlight))
+	for job := range p.inFlight {
+		ids = append(ids, job.GetMessage().GetID())
+	}
+	return ids
+}
+
+// count updates statistics with outcome of processed jobs: acknowledged jobs are processed, rejected ones and
+// jobs left unresolved by error are failed. Released jobs are not counted
+func (p *ParallelProcessing) count(err error, jobs ...*qp.SimpleJob) {
+	for _, job := range jobs {
+		switch {
+		case job.IsAcknowledged():
+			atomic.AddInt64(&p.processed, 1)
+		case job.IsRejected() || err != nil:
+			atomic.AddInt64(&p.failed, 1)
+		}
+	}
+}
+
+func (p *ParallelProcessing) handleError(err error, logger *log.Entry) {
+	if err == nil {
+		return
+	}
+	switch p.configuration.OnProcessingError {
+	case OnProcessingErrorIgnore:
+	case OnProcessingErrorWarning:
+		logger.WithField("error", err.Error()).Warn("Error on job processing")
+	case OnProcessingErrorPanic:
+		logger.WithField("error", err.Error()).Error("Error on job processing")
+		panic("Error while processing: " + err.Error())
+	}
+}
+
+// collectBatches groups jobs into batches of BatchSize. Incomplete batch is passed to workers after BatchTimeout.
+// Batches which were not started before stop are released
+func (p *ParallelProcessing) collectBatches() {
+	releaseBatch := func(batch []*qp.SimpleJob) {
+		for _, job := range batch {
+			p.release(job, p.logger)
+		}
+	}
+	defer func() {
+		for drained := false; !drained; {
+			select {
+			case batch := <-p.batches:
+				releaseBatch(batch)
+			default:
+				drained = true
+			}
+		}
+		close(p.batches)
+	}()
+
+	var batch []*qp.SimpleJob
+	var timeout <-chan time.Time
+	flush := func() {
+		if len(batch) > 0 {
+			select {
+			case p.batches <- batch:
+			case <-p.stop:
+				releaseBatch(batch)
+			}
+			batch = nil
+		}
+		timeout = nil
+	}
+
+	for {
+		select {
+		case job, ok := <-p.jobs:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, job)
+			if len(batch) == 1 {
+				timeout = time.After(time.Duration(p.configuration.BatchTimeout) * time.Millisecond)
+			}
+			if len(batch) >= p.configuration.BatchSize {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+// processJob acknowledges duplicate jobs without processing and postpones jobs whose copy is being processed,
+// other jobs are processed. Key of acknowledged job is remembered by deduplicator, key of failed one is released
+func (p *ParallelProcessing) processJob(job *qp.SimpleJob, logger *log.Entry) error {
+	if p.deduplicator == nil {
+		return p.runJob(job, logger)
+	}
+
+	key, reservation := p.reserveKey(job, logger)
+	switch reservation {
+	case dedup.Duplicate:
+		return job.AckMessage()
+	case dedup.InFlight:
+		return p.postpone(job, logger)
+	}
+
+	err := p.runJob(job, logger)
+	p.settleKey(job, key)
+	return err
+}
+
+// processBatch acknowledges duplicate jobs without processing and postpones jobs whose copy is being processed
+// (in this or another batch), other jobs are processed as one batch
+func (p *ParallelProcessing) processBatch(jobs []*qp.SimpleJob, logger *log.Entry) error {
+	if p.deduplicator == nil {
+		return p.runBatch(jobs, logger)
+	}
+
+	// error of one duplicate does not stop the rest of the batch, errors are collected
+	keys := make(map[*qp.SimpleJob]string)
+	var pending []*qp.SimpleJob
+	var errs []string
+	for _, job := range jobs {
+		key, reservation := p.reserveKey(job, logger)
+		var err error
+		switch reservation {
+		case dedup.Duplicate:
+			err = job.AckMessage()
+		case dedup.InFlight:
+			err = p.postpone(job, logger)
+		default:
+			keys[job] = key
+			pending = append(pending, job)
+		}
+		if err != nil {
+			p.jobLogger(job, logger).WithError(err).Debug("Can't acknowledge or postpone duplicate job")
+			errs = append(errs, err.Error())
+		}
+	}
+
+	var err error
+	if len(pending) > 0 {
+		err = p.runBatch(pending, logger)
+	}
+	for job, key := range keys {
+		p.settleKey(job, key)
+	}
+	if err == nil && len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "; "))
+	}
+	return err
+}
+
+// reserveKey reserves deduplication key of the job. Jobs without key are processed (reserved with empty key)
+func (p *ParallelProcessing) reserveKey(job *qp.SimpleJob, logger *log.Entry) (string, int) {
+	key, err := p.deduplicator.Key(job.GetMessage())
+	if err != nil || key == "" {
+		p.jobLogger(job, logger).WithField("error", err).Warn("Can't build deduplication key. Job is processed")
+		return "", dedup.Reserved
+	}
+
+	reservation := p.deduplicator.Reserve(key)
+	switch reservation {
+	case dedup.Duplicate:
+		atomic.AddInt64(&p.duplicates, 1)
+		p.jobLogger(job, logger).WithField("key", key).Info("Duplicate job acknowledged without processing")
+	case dedup.InFlight:
+		p.jobLogger(job, logger).WithField("key", key).Info("Copy of the job is being processed")
+	}
+	return key, reservation
+}
+
+// settleKey remembers key of acknowledged job, key of job which was rejected or returned to the queue is released
+func (p *ParallelProcessing) settleKey(job *qp.SimpleJob, key string) {
+	if key == "" {
+		return
+	}
+	if job.IsAcknowledged() {
+		p.deduplicator.Remember(key)
+	} else {
+		p.deduplicator.Release(key)
+	}
+}
+
+// postpone returns job whose copy is being processed to the queue for RetryDelay (at least a second), so it is
+// deduplicated or processed once the copy is finished. Job of queue which can't delay messages is acknowledged
+// as duplicate
+func (p *ParallelProcessing) postpone(job *qp.SimpleJob, logger *log.Entry) error {
+	delay := time.Duration(p.configuration.RetryDelay) * time.Second
+	if delay < time.Second {
+		delay = time.Second
+	}
+	if delayable, ok := p.queue.(qp.IDelayableQueue); ok {
+		err := delayable.Delay(p.ctx, job.GetMessage(), delay)
+		if err == nil {
+			p.jobLogger(job, logger).WithField("delay", delay).Info("Job postponed")
+			return nil
+		}
+		if err != qp.ErrDelayNotSupported {
+			return err
+		}
+	}
+	atomic.AddInt64(&p.duplicates, 1)
+	return job.AckMessage()
+}
+
+// runBatch runs batch processor against the jobs, jobs left unresolved on qp.RetryError are retried
+func (p *ParallelProcessing) runBatch(jobs []*qp.SimpleJob, logger *log.Entry) error {
+	for len(jobs) > 0 {
+		batch := make([]qp.IJob, len(jobs))
+		for i, job := range jobs {
+			batch[i] = job
+		}
+
+		fields := p.batchFields(jobs, logger)
+		startedAt := time.Now()
+		err := p.attempt(fields, func(ctx context.Context) error {
+			links := make([]trace.Link, len(jobs))
+			for i, job := range jobs {
+				links[i] = trace.LinkFromContext(job.GetTraceContext())
+			}
+			ctx, span := qp.Tracer().Start(ctx, "qp.process_batch", trace.WithLinks(links...), trace.WithAttributes(
+				attribute.String("qp.strategy", p.configuration.Name),
+				attribute.String("qp.processor", p.configuration.Processor),
+				attribute.Int("qp.batch_size", len(jobs)),
+			))
+			err := p.batchProcessor.ProcessBatch(ctx, batch)
+			qp.EndSpan(span, err)
+			return err
+		})
+		logger.WithFields(fields).WithField(qp.LogFieldDuration, time.Since(startedAt)).Debug("Batch processed")
+		var pending []*qp.SimpleJob
+		for _, job := range jobs {
+			switch {
+			case job.IsRejected():
+				p.jobLogger(job, logger).WithField("reason", job.GetFailureReason()).Warn("Job failed")
+			case !job.IsAcknowledged():
+				pending = append(pending, job)
+			}
+		}
+
+		if p.ctx.Err() != nil {
+			p.releaseCancelled(pending, logger)
+			return nil
+		}
+
+		retry, ok := err.(*qp.RetryError)
+		if !ok {
+			return err
+		}
+		jobs = pending
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		if jobs[0].GetAttempt() > p.configuration.MaxRetries {
+			logger.WithFields(log.Fields{
+				"jobs":    len(jobs),
+				"attempt": jobs[0].GetAttempt(),
+				"reason":  retry.Error(),
+			}).Warn("Retries exhausted. Rejecting jobs")
+			for _, job := range jobs {
+				if err := job.RejectMessage(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		delay := retry.After
+		if delay == 0 {
+			delay = time.Duration(p.configuration.RetryDelay) * time.Second
+		}
+		logger.WithFields(log.Fields{
+			"jobs":    len(jobs),
+			"attempt": jobs[0].GetAttempt(),
+			"delay":   delay,
+		}).Info("Retrying jobs")
+		if !p.sleep(delay) {
+			p.releaseCancelled(jobs, logger)
+			return nil
+		}
+		for _, job := range jobs {
+			job.Retry()
+		}
+	}
+	return nil
+}
+
+// runJob runs processor against the job, retrying it on qp.RetryError
+func (p *ParallelProcessing) runJob(job *qp.SimpleJob, logger *log.Entry) error {
+	for {
+		startedAt := time.Now()
+		err := p.attempt(p.contextFields(job, logger), func(ctx context.Context) error {
+			ctx, span := qp.StartSpan(ctx, job.GetTraceContext(), "qp.process", p.spanAttributes(job)...)
+			err := p.processor.Process(ctx, job)
+			qp.EndSpan(span, err)
+			return err
+		})
+		p.jobLogger(job, logger).WithField(qp.LogFieldDuration, time.Since(startedAt)).Debug("Job processed")
+		if job.GetFailureReason() != "" {
+			p.jobLogger(job, logger).WithField("reason", job.GetFailureReason()).Warn("Job failed")
+		}
+
+		if p.ctx.Err() != nil {
+			p.releaseCancelled([]*qp.SimpleJob{job}, logger)
+			return nil
+		}
+
+		retry, ok := err.(*qp.RetryError)
+		if !ok {
+			return err
+		}
+
+		if job.GetAttempt() > p.configuration.MaxRetries {
+			p.jobLogger(job, logger).WithField("reason", retry.Error()).Warn("Retries exhausted. Rejecting job")
+			return job.RejectMessage()
+		}
+
+		delay := retry.After
+		if delay == 0 {
+			delay = time.Duration(p.configuration.RetryDelay) * time.Second
+		}
+		p.jobLogger(job, logger).WithField("delay", delay).Info("Retrying job")
+		if !p.sleep(delay) {
+			p.releaseCancelled([]*qp.SimpleJob{job}, logger)
+			return nil
+		}
+		job.Retry()
+	}
+}
+
+// attempt runs one processing attempt within JobTimeout. Attempt which ran out of time is retried.
+// Log fields are passed to processors with ctx (see qp.JobLogger)
+func (p *ParallelProcessing) attempt(fields log.Fields, process func(ctx context.Context) error) error {
+	ctx := qp.WithLogFields(p.ctx, fields)
+	if p.configuration.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.configuration.JobTimeout)*time.Second)
+		defer cancel()
+	}
+
+	err := process(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && p.ctx.Err() == nil {
+		return qp.NewRetryError(fmt.Errorf("Job timed out after %d seconds", p.configuration.JobTimeout), 0)
+	}
+	return err
+}
+
+// jobFields returns log fields of the job: strategy, queue and processor names, message ID, attempt and correlation ID
+func (p *ParallelProcessing) jobFields(job *qp.SimpleJob) log.Fields {
+	queue := p.configuration.Queue
+	if source := qp.SourceQueue(job.GetMessage()); source != "" {
+		queue = source
+	}
+	return log.Fields{
+		qp.LogFieldStrategy:      p.configuration.Name,
+		qp.LogFieldQueue:         queue,
+		qp.LogFieldProcessor:     p.configuration.Processor,
+		qp.LogFieldMessageID:     job.GetMessage().GetID(),
+		qp.LogFieldAttempt:       job.GetAttempt(),
+		qp.LogFieldCorrelationID: job.GetCorrelationID(),
+	}
+}
+
+// jobLogger returns logger with fields of the job
+func (p *ParallelProcessing) jobLogger(job *qp.SimpleJob, logger *log.Entry) *log.Entry {
+	return logger.WithFields(p.jobFields(job))
+}
+
+// contextFields returns log fields passed to processor of the job: job fields and worker
+func (p *ParallelProcessing) contextFields(job *qp.SimpleJob, logger *log.Entry) log.Fields {
+	fields := p.jobFields(job)
+	if worker, ok := logger.Data[qp.LogFieldWorker]; ok {
+		fields[qp.LogFieldWorker] = worker
+	}
+	return fields
+}
+
+// batchFields returns log fields passed to batch processor. Jobs of the batch share attempt number
+func (p *ParallelProcessing) batchFields(jobs []*qp.SimpleJob, logger *log.Entry) log.Fields {
+	fields := log.Fields{
+		qp.LogFieldStrategy:  p.configuration.Name,
+		qp.LogFieldQueue:     p.configuration.Queue,
+		qp.LogFieldProcessor: p.configuration.Processor,
+		qp.LogFieldAttempt:   jobs[0].GetAttempt(),
+		"jobs":               len(jobs),
+	}
+	correlationIDs := make([]string, len(jobs))
+	for i, job := range jobs {
+		correlationIDs[i] = job.GetCorrelationID()
+	}
+	fields[qp.LogFieldCorrelationID] = strings.Join(correlationIDs, ",")
+	if worker, ok := logger.Data[qp.LogFieldWorker]; ok {
+		fields[qp.LogFieldWorker] = worker
+	}
+	return fields
+}
+
+// traceConsume records consume span of the job (from consume start till message is received).
+// Parent span is taken from message attributes (traceparent), spans of the job are children of the consume span.
+// Failed consume is recorded without job
+func (p *ParallelProcessing) traceConsume(job *qp.SimpleJob, result *consumeResult) {
+	parent := context.Background()
+	var attributes []attribute.KeyValue
+	if job != nil {
+		parent = qp.ExtractTraceContext(parent, job.GetMessage())
+		attributes = p.spanAttributes(job)
+	}
+	ctx, span := qp.Tracer().Start(parent, "qp.consume",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithTimestamp(result.startedAt),
+		trace.WithAttributes(attributes...),
+	)
+	qp.EndSpan(span, result.err)
+	if job != nil {
+		job.SetTraceContext(ctx)
+	}
+}
+
+// spanAttributes returns span attributes of the job
+func (p *ParallelProcessing) spanAttributes(job *qp.SimpleJob) []attribute.KeyValue {
+	queue := p.configuration.Queue
+	if source := qp.SourceQueue(job.GetMessage()); source != "" {
+		queue = source
+	}
+	return []attribute.KeyValue{
+		attribute.String("qp.strategy", p.configuration.Name),
+		attribute.String("qp.queue", queue),
+		attribute.String("qp.processor", p.configuration.Processor),
+		attribute.String("messaging.message.id", fmt.Sprint(job.GetMessage().GetID())),
+		attribute.Int("qp.attempt", job.GetAttempt()),
+		attribute.String("qp.correlation_id", job.GetCorrelationID()),
+	}
+}
+
+// sleep waits for retry delay. Returns false if processing was cancelled meanwhile
+func (p *ParallelProcessing) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// releaseCancelled releases jobs left unresolved by cancelled processing
+func (p *ParallelProcessing) releaseCancelled(jobs []*qp.SimpleJob, logger *log.Entry) {
+	for _, job := range jobs {
+		if !job.IsAcknowledged() && !job.IsRejected() {
+			p.jobLogger(job, logger).Info("Job cancelled")
+			p.release(job, logger)
+		}
+	}
+}
+
 // Stop stops queue processing
 func (p *ParallelProcessing) Stop() error {
 	p.logger.Info("Stopping processing")
+	p.state.Lock()
+	if !p.process {
+		p.stopRequested = true
+		p.state.Unlock()
+		p.logger.Info("Strategy is not running")
+		return nil
+	}
+	atomic.StoreInt32(&p.stopping, 1)
 	p.process = false
-	p.stop <- true
+	close(p.stop)
+	p.cancelConsume()
+	p.state.Unlock()
 	p.wait.Wait()
 	p.logger.Info("Processing stopped")
 	return nil
 }
 
-// GetStatistics returns stats
+// Close frees resources of the strategy (deduplication store)
+func (p *ParallelProcessing) Close() error {
+	if p.deduplicator != nil {
+		return p.deduplicator.Close()
+	}
+	return nil
+}
+
+// recordConsume remembers result of the finished consume, see GetConsumeState
+func (p *ParallelProcessing) recordConsume(err error) {
+	p.consumeMutex.Lock()
+	p.consumeState.LastError = err
+	if err == nil {
+		p.consumeState.LastSucceededAt = time.Now()
+	}
+	p.consumeMutex.Unlock()
+}
+
+// recordPoll remembers outstanding request of consume to the queue until returned function is called
+func (p *ParallelProcessing) recordPoll(wait time.Duration) func() {
+	p.consumeMutex.Lock()
+	if p.polls == nil {
+		p.polls = make(map[int64]consumePoll)
+	}
+	p.pollID++
+	id := p.pollID
+	p.polls[id] = consumePoll{startedAt: time.Now(), wait: wait}
+	p.consumeMutex.Unlock()
+
+	return func() {
+		p.consumeMutex.Lock()
+		delete(p.polls, id)
+		p.consumeMutex.Unlock()
+	}
+}
+
+// GetConsumeState returns result of the last consume and request to the queue which is overdue first
+func (p *ParallelProcessing) GetConsumeState() qp.ConsumeState {
+	p.consumeMutex.Lock()
+	defer p.consumeMutex.Unlock()
+	state := p.consumeState
+	for _, poll := range p.polls {
+		if state.PollStartedAt.IsZero() || poll.startedAt.Add(poll.wait).Before(state.PollStartedAt.Add(state.PollWait)) {
+			state.PollStartedAt, state.PollWait = poll.startedAt, poll.wait
+		}
+	}
+	return state
+}
+
+// GetQueue returns queue consumed by the strategy
+func (p *ParallelProcessing) GetQueue() qp.IConsumableQueue {
+	return p.queue
+}
+
+// GetStatistics returns stats. They are collected in memory, queue is not queried (see qp.Context.Status)
 func (p *ParallelProcessing) GetStatistics() qp.Statistics {
+	p.state.Lock()
+	running, startedAt, timers := p.process, p.startedAt, p.timers
+	p.state.Unlock()
+
 	var status string
-	if p.process {
+	if running {
 		status = qp.StatusRunning
 	} else {
 		status = qp.StatusStopped
@@ -205,17 +1049,47 @@ func (p *ParallelProcessing) GetStatistics() qp.Statistics {
 	stats := qp.Statistics{
 		Status:            status,
 		QueueName:         p.configuration.Name,
-		ProcessedMessages: *big.NewInt(0),
-		FailedMessaged:    *big.NewInt(0),
-		StartedAt:         p.startedAt,
+		ProcessedMessages: *big.NewInt(atomic.LoadInt64(&p.processed)),
+		FailedMessaged:    *big.NewInt(atomic.LoadInt64(&p.failed)),
+		StartedAt:         startedAt,
 		MessagesInQueue:   *big.NewInt(0),
 	}
+	p.inFlightMutex.Lock()
+	stats.InFlight = len(p.inFlight)
+	p.inFlightMutex.Unlock()
+	if countersProvider, ok := p.processor.(qp.ICountersProvider); ok {
+		stats.Counters = countersProvider.GetCounters()
+	}
+	if countersProvider, ok := p.queue.(qp.ICountersProvider); ok {
+		if stats.Counters == nil {
+			stats.Counters = make(map[string]int64)
+		}
+		for name, value := range countersProvider.GetCounters() {
+			stats.Counters[name] = value
+		}
+	}
+	if p.deduplicator != nil {
+		if stats.Counters == nil {
+			stats.Counters = make(map[string]int64)
+		}
+		stats.Counters["dedup.duplicates"] = atomic.LoadInt64(&p.duplicates)
+	}
+	if p.scheduler != nil {
+		if stats.Counters == nil {
+			stats.Counters = make(map[string]int64)
+		}
+		stats.Counters["delay.delayed"] = atomic.LoadInt64(&p.delayed)
+		if timers != nil {
+			stats.Counters["delay.held"] = int64(timers.Len())
+		}
+	}
 	p.logger.WithFields(log.Fields{
 		"Status":            stats.Status,
 		"ProcessedMessages": stats.ProcessedMessages,
 		"FailedMessaged":    stats.FailedMessaged,
 		"StartedAt":         stats.StartedAt,
-		"MessagesInQueue":   stats.MessagesInQueue,
+		"InFlight":          stats.InFlight,
+		"Counters":          stats.Counters,
 	}).Debug("Statistics")
 	return stats
 }
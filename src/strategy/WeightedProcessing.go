@@ -0,0 +1,75 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+)
+
+// WeightedProcessing - processing strategy which consumes several queues with weights
+// (e.g. 80% high-priority and 20% bulk) and feeds one processor and worker pool.
+// All other options are the same as ParallelProcessing ones
+type WeightedProcessing struct {
+	ParallelProcessing
+	weightedConfiguration weightedProcessingConfiguration
+}
+
+type weightedProcessingConfiguration struct {
+	Queues []struct {
+		Queue  string `ref:"queue"`
+		Weight int
+	}
+}
+
+// weightedProcessingOptions - all options of WeightedProcessing strategy
+type weightedProcessingOptions struct {
+	parallelProcessingConfiguration
+	weightedProcessingConfiguration
+}
+
+// Options returns options struct of the strategy
+func (w *WeightedProcessing) Options() interface{} {
+	return &weightedProcessingOptions{}
+}
+
+// Configure configures strategy
+func (w *WeightedProcessing) Configure(configuration map[string]interface{}, context *qp.Context) error {
+	parallelConfiguration := make(map[string]interface{})
+	for name, value := range configuration {
+		if name != "Queues" {
+			parallelConfiguration[name] = value
+		}
+	}
+	if _, ok := parallelConfiguration["Queue"]; ok {
+		return errors.New("WeightedProcessing strategy uses Queues option instead of Queue")
+	}
+
+	if err := utils.Decode(map[string]interface{}{"Queues": configuration["Queues"]}, &w.weightedConfiguration); err != nil {
+		return err
+	}
+	if len(w.weightedConfiguration.Queues) == 0 {
+		return errors.New("WeightedProcessing strategy should have at least one of Queues")
+	}
+
+	var names []string
+	var queues []qp.IConsumableQueue
+	var weights []int
+	for _, queueConfiguration := range w.weightedConfiguration.Queues {
+		queue, ok := context.AvailableQueues[queueConfiguration.Queue]
+		if !ok {
+			return fmt.Errorf("Unknown Queue [%s] requested", queueConfiguration.Queue)
+		}
+		if queueConfiguration.Weight == 0 {
+			queueConfiguration.Weight = 1
+		}
+		if queueConfiguration.Weight < 0 {
+			return fmt.Errorf("Weight of queue [%s] should be > 0", queueConfiguration.Queue)
+		}
+		names = append(names, queueConfiguration.Queue)
+		queues = append(queues, *queue)
+		weights = append(weights, queueConfiguration.Weight)
+	}
+
+	return w.configure(parallelConfiguration, context, "WeightedProcessing", qp.NewWeightedQueue(names, queues, weights))
+}
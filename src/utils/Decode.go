@@ -0,0 +1,356 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldError - problem with one option, Path is YAML path of the option (e.g. strategy[0].options.MaxThreads)
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+// DecodeError - all problems found in options
+type DecodeError struct {
+	Errors []FieldError
+}
+
+// Reference - option which refers to other component of the configuration (tag `ref:"queue"`)
+type Reference struct {
+	Path string
+	Kind string
+	Name string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+func (e *DecodeError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, fieldError := range e.Errors {
+		lines[i] = fieldError.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Add adds problem found at path
+func (e *DecodeError) Add(path string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Merge adds problems of err to e. DecodeError paths are prefixed with prefix, other errors are reported at prefix
+func (e *DecodeError) Merge(prefix string, err error) {
+	decodeError, ok := err.(*DecodeError)
+	if !ok {
+		e.Add(prefix, "%s", err.Error())
+		return
+	}
+	for _, fieldError := range decodeError.Errors {
+		e.Errors = append(e.Errors, FieldError{Path: JoinPath(prefix, fieldError.Path), Message: fieldError.Message})
+	}
+}
+
+// OrNil returns nil if there are no problems
+func (e *DecodeError) OrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// JoinPath joins YAML path parts
+func JoinPath(prefix string, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case path == "" || strings.HasPrefix(path, "["):
+		return prefix + path
+	}
+	return prefix + "." + path
+}
+
+// Decode fills struct pointed by target from generic options map (as decoded from YAML).
+// Target is reset first, options which are not provided take value of `default` tag
+// (comma separated for lists), options tagged with `required:"true"` should be provided. Values are coerced when it is lossless: 10 -> 10.0, 10.0 -> 10, "10" -> 10, 10 -> "10".
+// Every unknown option and type mismatch is reported in returned DecodeError
+func Decode(options map[string]interface{}, target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Decode target should be pointer to struct, %T given", target)
+	}
+
+	errs := &DecodeError{}
+	value.Elem().Set(reflect.Zero(value.Elem().Type()))
+	applyDefaults("", value.Elem(), errs)
+	decodeValue("", reflect.ValueOf(options), value.Elem(), errs)
+	return errs.OrNil()
+}
+
+// References returns all references (fields with `ref` tag) of decoded options struct
+func References(options interface{}) []Reference {
+	var references []Reference
+	collectReferences("", reflect.ValueOf(options), "", &references)
+	return references
+}
+
+func collectReferences(path string, value reflect.Value, kind string, references *[]Reference) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			collectReferences(path, value.Elem(), kind, references)
+		}
+	case reflect.Struct:
+		for _, field := range structFields(value.Type()) {
+			collectReferences(JoinPath(path, field.Name), value.FieldByIndex(field.Index), field.Tag.Get("ref"), references)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			collectReferences(fmt.Sprintf("%s[%d]", path, i), value.Index(i), kind, references)
+		}
+	case reflect.String:
+		if kind != "" && value.String() != "" {
+			*references = append(*references, Reference{Path: path, Kind: kind, Name: value.String()})
+		}
+	}
+}
+
+// structFields returns exported fields of struct type, fields of embedded structs are promoted
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, promoted := range structFields(field.Type) {
+				promoted.Index = append([]int{i}, promoted.Index...)
+				fields = append(fields, promoted)
+			}
+			continue
+		}
+		if field.PkgPath == "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func applyDefaults(path string, value reflect.Value, errs *DecodeError) {
+	for _, field := range structFields(value.Type()) {
+		fieldValue := value.FieldByIndex(field.Index)
+		fieldPath := JoinPath(path, field.Name)
+		if defaultValue, ok := field.Tag.Lookup("default"); ok {
+			var source interface{} = defaultValue
+			if fieldValue.Kind() == reflect.Slice {
+				source = strings.Split(defaultValue, ",")
+			}
+			decodeValue(fieldPath, reflect.ValueOf(source), fieldValue, errs)
+		} else if fieldValue.Kind() == reflect.Struct {
+			applyDefaults(fieldPath, fieldValue, errs)
+		}
+	}
+}
+
+func decodeValue(path string, source reflect.Value, target reflect.Value, errs *DecodeError) {
+	for source.IsValid() && source.Kind() == reflect.Interface {
+		if source.IsNil() {
+			return
+		}
+		source = source.Elem()
+	}
+	if !source.IsValid() {
+		return
+	}
+
+	switch target.Kind() {
+	case reflect.Interface:
+		if !source.Type().AssignableTo(target.Type()) {
+			errs.Add(path, "%s expected, %s given", target.Type(), describe(source))
+			return
+		}
+		target.Set(source)
+	case reflect.Ptr:
+		value := reflect.New(target.Type().Elem())
+		if value.Elem().Kind() == reflect.Struct {
+			applyDefaults(path, value.Elem(), errs)
+		}
+		decodeValue(path, source, value.Elem(), errs)
+		target.Set(value)
+	case reflect.Struct:
+		decodeStruct(path, source, target, errs)
+	case reflect.Slice:
+		if source.Kind() != reflect.Slice {
+			errs.Add(path, "list expected, %s given", describe(source))
+			return
+		}
+		result := reflect.MakeSlice(target.Type(), source.Len(), source.Len())
+		for i := 0; i < source.Len(); i++ {
+			if result.Index(i).Kind() == reflect.Struct {
+				applyDefaults(fmt.Sprintf("%s[%d]", path, i), result.Index(i), errs)
+			}
+			decodeValue(fmt.Sprintf("%s[%d]", path, i), source.Index(i), result.Index(i), errs)
+		}
+		target.Set(result)
+	case reflect.Map:
+		if source.Kind() != reflect.Map {
+			errs.Add(path, "map expected, %s given", describe(source))
+			return
+		}
+		result := reflect.MakeMapWithSize(target.Type(), source.Len())
+		for _, key := range source.MapKeys() {
+			keyPath := JoinPath(path, fmt.Sprint(key.Interface()))
+			convertedKey := reflect.New(target.Type().Key()).Elem()
+			decodeValue(keyPath, key, convertedKey, errs)
+			convertedValue := reflect.New(target.Type().Elem()).Elem()
+			decodeValue(keyPath, source.MapIndex(key), convertedValue, errs)
+			result.SetMapIndex(convertedKey, convertedValue)
+		}
+		target.Set(result)
+	default:
+		if err := decodeScalar(source, target); err != nil {
+			errs.Add(path, "%s", err.Error())
+		}
+	}
+}
+
+func decodeStruct(path string, source reflect.Value, target reflect.Value, errs *DecodeError) {
+	if source.Kind() != reflect.Map {
+		errs.Add(path, "map expected, %s given", describe(source))
+		return
+	}
+
+	fields := make(map[string]reflect.StructField)
+	for _, field := range structFields(target.Type()) {
+		fields[field.Name] = field
+		if field.Tag.Get("required") == "true" && !source.MapIndex(reflect.ValueOf(field.Name)).IsValid() {
+			errs.Add(JoinPath(path, field.Name), "option is required")
+		}
+	}
+
+	keys := source.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	for _, key := range keys {
+		name := fmt.Sprint(key.Interface())
+		field, ok := fields[name]
+		if !ok {
+			errs.Add(JoinPath(path, name), "unknown option%s", suggest(name, fields))
+			continue
+		}
+		decodeValue(JoinPath(path, name), source.MapIndex(key), target.FieldByIndex(field.Index), errs)
+	}
+}
+
+// suggest returns hint for option name mistyped in letter case
+func suggest(name string, fields map[string]reflect.StructField) string {
+	for fieldName := range fields {
+		if strings.EqualFold(fieldName, name) {
+			return ", did you mean " + fieldName + "?"
+		}
+	}
+	return ""
+}
+
+func decodeScalar(source reflect.Value, target reflect.Value) error {
+	mismatch := fmt.Errorf("%s expected, %s given", target.Kind(), describe(source))
+
+	switch target.Kind() {
+	case reflect.String:
+		switch {
+		case source.Kind() == reflect.String:
+			target.SetString(source.String())
+		case source.Kind() == reflect.Bool || isNumeric(source.Kind()):
+			target.SetString(fmt.Sprint(source.Interface()))
+		default:
+			return mismatch
+		}
+	case reflect.Bool:
+		switch source.Kind() {
+		case reflect.Bool:
+			target.SetBool(source.Bool())
+		case reflect.String:
+			value, err := strconv.ParseBool(source.String())
+			if err != nil {
+				return mismatch
+			}
+			target.SetBool(value)
+		default:
+			return mismatch
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, ok := toFloat(source)
+		if !ok || value != math.Trunc(value) {
+			return mismatch
+		}
+		if target.OverflowInt(int64(value)) {
+			return fmt.Errorf("value %v overflows %s", value, target.Kind())
+		}
+		target.SetInt(int64(value))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, ok := toFloat(source)
+		if !ok || value != math.Trunc(value) || value < 0 {
+			return mismatch
+		}
+		if target.OverflowUint(uint64(value)) {
+			return fmt.Errorf("value %v overflows %s", value, target.Kind())
+		}
+		target.SetUint(uint64(value))
+	case reflect.Float32, reflect.Float64:
+		value, ok := toFloat(source)
+		if !ok {
+			return mismatch
+		}
+		target.SetFloat(value)
+	default:
+		return fmt.Errorf("options of type %s are not supported", target.Type())
+	}
+	return nil
+}
+
+func toFloat(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value.String()), 64)
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+// describe returns YAML-ish name of the value type for error messages
+func describe(value reflect.Value) string {
+	switch {
+	case value.Kind() == reflect.Map:
+		return "map"
+	case value.Kind() == reflect.Slice:
+		return "list"
+	case value.Kind() == reflect.String:
+		return fmt.Sprintf("string %q", value.String())
+	case value.Kind() == reflect.Bool || isNumeric(value.Kind()):
+		return fmt.Sprintf("%s %v", value.Kind(), value.Interface())
+	}
+	return value.Type().String()
+}
+
+func isNumeric(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
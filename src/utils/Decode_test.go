@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type decodeItem struct {
+	Name   string `required:"true"`
+	Weight int    `default:"1"`
+}
+
+type decodeOptions struct {
+	Threads int `default:"4"`
+	Ratio   float64
+	Enabled bool
+	Label   string
+	Small   int8
+	Count   uint
+	Tags    []string `default:"a,b"`
+	Items   []decodeItem
+	Item    *decodeItem
+	Limits  map[string]int
+	Queue   string `ref:"queue"`
+}
+
+func TestDecode(t *testing.T) {
+	defaults := decodeOptions{Threads: 4, Tags: []string{"a", "b"}}
+	with := func(change func(options *decodeOptions)) decodeOptions {
+		options := defaults
+		change(&options)
+		return options
+	}
+
+	tests := []struct {
+		name     string
+		options  map[string]interface{}
+		expected decodeOptions
+		errors   []string
+	}{
+		{
+			name:     "defaults",
+			options:  map[string]interface{}{},
+			expected: defaults,
+		},
+		{
+			name:     "provided list replaces default",
+			options:  map[string]interface{}{"Tags": []interface{}{"x"}},
+			expected: with(func(o *decodeOptions) { o.Tags = []string{"x"} }),
+		},
+		{
+			name:     "string coerced to int",
+			options:  map[string]interface{}{"Threads": " 10 "},
+			expected: with(func(o *decodeOptions) { o.Threads = 10 }),
+		},
+		{
+			name:     "whole float coerced to int",
+			options:  map[string]interface{}{"Threads": 10.0},
+			expected: with(func(o *decodeOptions) { o.Threads = 10 }),
+		},
+		{
+			name:     "int coerced to float",
+			options:  map[string]interface{}{"Ratio": 2},
+			expected: with(func(o *decodeOptions) { o.Ratio = 2 }),
+		},
+		{
+			name:     "scalars coerced to string",
+			options:  map[string]interface{}{"Label": 10, "Queue": true},
+			expected: with(func(o *decodeOptions) { o.Label, o.Queue = "10", "true" }),
+		},
+		{
+			name:     "string coerced to bool",
+			options:  map[string]interface{}{"Enabled": "true"},
+			expected: with(func(o *decodeOptions) { o.Enabled = true }),
+		},
+		{
+			name:    "fractional float is not int",
+			options: map[string]interface{}{"Threads": 1.5},
+			errors:  []string{"Threads: int expected, float64 1.5 given"},
+		},
+		{
+			name:    "not a number",
+			options: map[string]interface{}{"Threads": "ten"},
+			errors:  []string{`Threads: int expected, string "ten" given`},
+		},
+		{
+			name:    "not a bool",
+			options: map[string]interface{}{"Enabled": "yes"},
+			errors:  []string{`Enabled: bool expected, string "yes" given`},
+		},
+		{
+			name:    "negative uint",
+			options: map[string]interface{}{"Count": -1},
+			errors:  []string{"Count: uint expected, int -1 given"},
+		},
+		{
+			name:    "overflow",
+			options: map[string]interface{}{"Small": 300},
+			errors:  []string{"Small: value 300 overflows int8"},
+		},
+		{
+			name:    "map is not a string",
+			options: map[string]interface{}{"Label": map[interface{}]interface{}{"a": 1}},
+			errors:  []string{"Label: string expected, map given"},
+		},
+		{
+			name:    "scalar is not a list",
+			options: map[string]interface{}{"Tags": "a"},
+			errors:  []string{`Tags: list expected, string "a" given`},
+		},
+		{
+			name: "defaults of structs in list",
+			options: map[string]interface{}{"Items": []interface{}{
+				map[interface{}]interface{}{"Name": "x"},
+				map[interface{}]interface{}{"Name": "y", "Weight": 5},
+			}},
+			expected: with(func(o *decodeOptions) { o.Items = []decodeItem{{"x", 1}, {"y", 5}} }),
+		},
+		{
+			name: "required option of struct in list",
+			options: map[string]interface{}{"Items": []interface{}{
+				map[interface{}]interface{}{"Name": "x"},
+				map[interface{}]interface{}{"Weight": 2},
+			}},
+			errors: []string{"Items[1].Name: option is required"},
+		},
+		{
+			name:     "defaults of struct pointer",
+			options:  map[string]interface{}{"Item": map[interface{}]interface{}{"Name": "x"}},
+			expected: with(func(o *decodeOptions) { o.Item = &decodeItem{"x", 1} }),
+		},
+		{
+			name:     "map values coerced",
+			options:  map[string]interface{}{"Limits": map[interface{}]interface{}{"a": "3"}},
+			expected: with(func(o *decodeOptions) { o.Limits = map[string]int{"a": 3} }),
+		},
+		{
+			name:    "map value mismatch",
+			options: map[string]interface{}{"Limits": map[interface{}]interface{}{"a": "many"}},
+			errors:  []string{`Limits.a: int expected, string "many" given`},
+		},
+		{
+			name:    "unknown options",
+			options: map[string]interface{}{"threads": 1, "Foo": 2},
+			errors:  []string{"Foo: unknown option", "threads: unknown option, did you mean Threads?"},
+		},
+		{
+			name: "all problems reported",
+			options: map[string]interface{}{
+				"Threads": "ten",
+				"Small":   -200,
+				"Items":   []interface{}{map[interface{}]interface{}{"Name": "x", "Weight": 0.5}},
+			},
+			errors: []string{
+				"Items[0].Weight: int expected, float64 0.5 given",
+				"Small: value -200 overflows int8",
+				`Threads: int expected, string "ten" given`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := decodeOptions{Label: "previous"}
+			err := Decode(test.options, &options)
+			if test.errors != nil {
+				if err == nil {
+					t.Fatalf("expected errors %q, got none", test.errors)
+				}
+				if err.Error() != strings.Join(test.errors, "\n") {
+					t.Fatalf("expected errors %q, got %q", test.errors, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(options, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, options)
+			}
+		})
+	}
+}
+
+func TestDecodeTarget(t *testing.T) {
+	if err := Decode(map[string]interface{}{}, decodeOptions{}); err == nil {
+		t.Fatal("expected error for non-pointer target")
+	}
+}
+
+func TestReferences(t *testing.T) {
+	options := struct {
+		Queue     string   `ref:"queue"`
+		Processor string   `ref:"processor"`
+		Stages    []string `ref:"processor"`
+		Label     string
+	}{Queue: "q", Stages: []string{"a", "b"}, Label: "l"}
+
+	expected := []Reference{
+		{Path: "Queue", Kind: "queue", Name: "q"},
+		{Path: "Stages[0]", Kind: "processor", Name: "a"},
+		{Path: "Stages[1]", Kind: "processor", Name: "b"},
+	}
+	if references := References(options); !reflect.DeepEqual(references, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, references)
+	}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema returns JSON Schema of options struct (as returned by Options() of components).
+// Defaults are taken from `default` tags, options tagged with `required:"true"` are required
+func Schema(options interface{}) map[string]interface{} {
+	return typeSchema(reflect.TypeOf(options))
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		for _, field := range structFields(t) {
+			schema := typeSchema(field.Type)
+			if defaultValue, ok := field.Tag.Lookup("default"); ok {
+				schema["default"] = parseDefault(field.Type, defaultValue)
+			}
+			if kind := field.Tag.Get("ref"); kind != "" {
+				schema["description"] = "Name of " + kind
+			}
+			if field.Tag.Get("required") == "true" {
+				required = append(required, field.Name)
+			}
+			properties[field.Name] = schema
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	if isNumeric(t.Kind()) {
+		return map[string]interface{}{"type": "integer"}
+	}
+	return map[string]interface{}{}
+}
+
+// parseDefault returns value of `default` tag decoded as option of type t
+func parseDefault(t reflect.Type, defaultValue string) interface{} {
+	var source interface{} = defaultValue
+	if t.Kind() == reflect.Slice {
+		source = strings.Split(defaultValue, ",")
+	}
+	value := reflect.New(t).Elem()
+	decodeValue("", reflect.ValueOf(source), value, &DecodeError{})
+	return value.Interface()
+}
@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"github.com/xeipuuv/gojsonschema"
+	"path/filepath"
+	"strings"
+)
+
+// OnInvalid constants
+const (
+	OnInvalidReject     = "reject"
+	OnInvalidDeadLetter = "deadletter"
+)
+
+// ErrorsAttribute - message attribute with validation errors of dead-lettered message
+const ErrorsAttribute = "qp-validation-errors"
+
+// Validator - validates message bodies against JSON Schema and handles invalid jobs.
+// Shared by Validate processor and Validate middleware
+type Validator struct {
+	configuration Configuration
+	schema        *gojsonschema.Schema
+	deadLetter    qp.IPublishableQueue
+	logger        *log.Entry
+}
+
+// Configuration - validator configuration
+type Configuration struct {
+	Schema          string
+	OnInvalid       string `default:"reject"`
+	DeadLetterQueue string `ref:"queue"`
+}
+
+// Configure - configure validator from generic options map
+func (v *Validator) Configure(configuration map[string]interface{}, logger *log.Entry) error {
+	if err := utils.Decode(configuration, &v.configuration); err != nil {
+		return err
+	}
+
+	if v.configuration.Schema == "" {
+		return errors.New("Schema setting should not be empty")
+	}
+
+	switch v.configuration.OnInvalid {
+	case OnInvalidReject:
+	case OnInvalidDeadLetter:
+		if v.configuration.DeadLetterQueue == "" {
+			return errors.New("DeadLetterQueue setting is required for OnInvalid: deadletter")
+		}
+	default:
+		return fmt.Errorf("Unknown OnInvalid value [%s]", v.configuration.OnInvalid)
+	}
+
+	path, err := filepath.Abs(v.configuration.Schema)
+	if err != nil {
+		return err
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(path)))
+	if err != nil {
+		return fmt.Errorf("Can't load schema %s: %s", v.configuration.Schema, err.Error())
+	}
+	v.schema = schema
+	v.logger = logger
+
+	return nil
+}
+
+// Link - resolve dead-letter queue
+func (v *Validator) Link(context *qp.Context) error {
+	if v.configuration.OnInvalid != OnInvalidDeadLetter {
+		return nil
+	}
+	queue, ok := context.AvailableQueues[v.configuration.DeadLetterQueue]
+	if !ok {
+		return fmt.Errorf("Unknown DeadLetterQueue [%s] requested", v.configuration.DeadLetterQueue)
+	}
+	publishable, ok := (*queue).(qp.IPublishableQueue)
+	if !ok {
+		return fmt.Errorf("Queue [%s] does not support publishing", v.configuration.DeadLetterQueue)
+	}
+	v.deadLetter = publishable
+	return nil
+}
+
+// Validate returns list of validation errors of message body. Empty list - body is valid
+func (v *Validator) Validate(message qp.IMessage) []string {
+	var loader gojsonschema.JSONLoader
+	switch body := message.GetBody().(type) {
+	case string:
+		loader = gojsonschema.NewStringLoader(body)
+	case []byte:
+		loader = gojsonschema.NewBytesLoader(body)
+	default:
+		loader = gojsonschema.NewGoLoader(body)
+	}
+
+	result, err := v.schema.Validate(loader)
+	if err != nil {
+		return []string{"Body is not valid JSON: " + err.Error()}
+	}
+
+	var errs []string
+	for _, resultError := range result.Errors() {
+		errs = append(errs, resultError.String())
+	}
+	return errs
+}
+
+// HandleInvalid rejects or dead-letters invalid job within ctx. Dead-lettered message is acknowledged in the original queue,
+// composed processors (e.g. Pipeline) do not process it any further
+func (v *Validator) HandleInvalid(ctx context.Context, job qp.IJob, errs []string) error {
+	reason := "Validation failed: " + strings.Join(errs, "; ")
+	if failureAware, ok := job.(qp.IFailureAwareJob); ok {
+		failureAware.SetFailureReason(reason)
+	}
+
+	if v.deadLetter != nil {
+		encodedErrors, err := json.Marshal(errs)
+		if err != nil {
+			return err
+		}
+
+		// message is dead-lettered as it was consumed, validation errors attribute overrides the same one of the message
+		message := job.GetMessage()
+		deadLetterMessage := &qp.Message{
+			ID:         message.GetID(),
+			Body:       qp.OriginalBody(message),
+			Raw:        message.GetRaw(),
+			Attributes: make(map[string]string),
+		}
+		for name, value := range message.GetAttributes() {
+			deadLetterMessage.Attributes[name] = value
+		}
+		deadLetterMessage.Attributes[ErrorsAttribute] = string(encodedErrors)
+
+		if err := qp.PublishEncoded(ctx, v.deadLetter, deadLetterMessage); err != nil {
+			v.logger.WithError(err).Error("Error on dead-letter publish")
+			return err
+		}
+		if ackError := qp.AckDeadLettered(job); ackError != nil {
+			v.logger.WithError(ackError).Debug("Error on MessageAcknowledge")
+			return ackError
+		}
+		v.logger.WithField("reason", reason).Debug("Job dead-lettered")
+		return nil
+	}
+
+	if rejectError := job.RejectMessage(); rejectError != nil {
+		v.logger.WithError(rejectError).Debug("Error on MessageReject")
+		return rejectError
+	}
+	v.logger.WithField("reason", reason).Debug("Job rejected")
+	return nil
+}
@@ -0,0 +1,75 @@
+package qp
+
+import (
+	"fmt"
+	core "github.com/iVariable/qp/src/qp"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Status output formats of qp status command
+const (
+	StatusFormatTable = "table"
+	StatusFormatJSON  = "json"
+	StatusFormatTop   = "top"
+)
+
+// RenderStatus writes status as a table. If previous status is given, throughput and error rate are calculated
+// for the time between the two, otherwise they are averaged since strategy start
+func RenderStatus(w io.Writer, status *Status, previous *Status) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "STRATEGY\tTYPE\tSTATUS\tUPTIME\tPROCESSED\tFAILED\tIN-FLIGHT\tQUEUE\tTHROUGHPUT\tERROR RATE")
+	for _, strategy := range status.Strategies {
+		uptime := "-"
+		if !strategy.StartedAt.IsZero() {
+			uptime = status.Time.Sub(strategy.StartedAt).Round(time.Second).String()
+		}
+		queueDepth := "-"
+		if strategy.QueueDepth != nil {
+			queueDepth = fmt.Sprintf("%d", *strategy.QueueDepth)
+		}
+		throughput, errorRate := strategy.Throughput, strategy.ErrorRate
+		if before := previousStrategy(previous, strategy); before != nil {
+			throughput, errorRate = core.Rates(
+				strategy.Processed-before.Processed,
+				strategy.Failed-before.Failed,
+				status.Time.Sub(previous.Time),
+			)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%.1f/s\t%.1f%%\n",
+			strategy.Name, strategy.Type, strategy.Status, uptime, strategy.Processed, strategy.Failed,
+			strategy.InFlight, queueDepth, throughput, errorRate*100)
+	}
+	table.Flush()
+
+	for _, strategy := range status.Strategies {
+		if len(strategy.Counters) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(strategy.Counters))
+		for name := range strategy.Counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "\nCounters of %s:\n", strategy.Name)
+		for _, name := range names {
+			fmt.Fprintf(table, "  %s\t%d\n", name, strategy.Counters[name])
+		}
+		table.Flush()
+	}
+}
+
+// previousStrategy returns status of the same strategy run in previous status, nil if strategy was restarted
+func previousStrategy(previous *Status, strategy core.StrategyStatus) *core.StrategyStatus {
+	if previous == nil {
+		return nil
+	}
+	for _, before := range previous.Strategies {
+		if before.Name == strategy.Name && before.StartedAt.Equal(strategy.StartedAt) {
+			return &before
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package qp
+
+import (
+	"context"
+	"fmt"
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"os"
+	"time"
+)
+
+// Tracing exporters
+const (
+	TracingExporterOTLP = "otlp"
+	TracingExporterFile = "file"
+)
+
+// Tracing defaults
+const (
+	defaultTracingEndpoint    = "localhost:4317"
+	defaultTracingServiceName = "qp"
+	tracingShutdownTimeout    = 5 * time.Second
+)
+
+// tracerProvider - provider configured by loadTracing, it is shut down (spans are flushed) when tracing
+// is configured again and on termination
+var tracerProvider *sdktrace.TracerProvider
+
+// traceFile - spans file opened by loadTracing for file exporter
+var traceFile *os.File
+
+// loadTracing configures exporter and sampler of the tracer provider. Tracing is disabled if exporter is not set
+func loadTracing(context *Context) error {
+	config := context.Configuration.General.Tracing
+	if err := tracingConfigErrors(config).OrNil(); err != nil {
+		return fmt.Errorf("Wrong tracing configuration: %s", err.Error())
+	}
+
+	var provider *sdktrace.TracerProvider
+	var file *os.File
+	if config.Exporter != "" {
+		exporter, opened, err := newTraceExporter(config)
+		if err != nil {
+			return fmt.Errorf("Can't create %s trace exporter: %s", config.Exporter, err.Error())
+		}
+		file = opened
+
+		serviceName := config.ServiceName
+		if serviceName == "" {
+			serviceName = defaultTracingServiceName
+		}
+		ratio := config.SampleRatio
+		if ratio == 0 {
+			ratio = 1
+		}
+		provider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		)
+	}
+
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+	} else {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	}
+
+	shutdownTracing()
+	tracerProvider, traceFile = provider, file
+	return nil
+}
+
+// newTraceExporter returns exporter of the tracing configuration and spans file it writes to (file exporter)
+func newTraceExporter(config core.TracingConfig) (sdktrace.SpanExporter, *os.File, error) {
+	if config.Exporter == TracingExporterFile {
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file, nil
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultTracingEndpoint
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), options...)
+	return exporter, nil, err
+}
+
+// reloadTracing applies changed tracing configuration, errors are logged and the running tracing is kept
+func reloadTracing(context *Context) {
+	if err := loadTracing(context); err != nil {
+		logger.WithField("error", err).Error("Can't configure tracing")
+	}
+}
+
+// shutdownTracing flushes spans of the running tracer provider and closes its exporter
+func shutdownTracing() {
+	if tracerProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			logger.WithField("error", err).Error("Error flushing spans")
+		}
+		cancel()
+		tracerProvider = nil
+	}
+	if traceFile != nil {
+		traceFile.Close()
+		traceFile = nil
+	}
+}
+
+// tracingConfigErrors returns problems of tracing configuration
+func tracingConfigErrors(config core.TracingConfig) *utils.DecodeError {
+	errs := &utils.DecodeError{}
+	switch config.Exporter {
+	case "", TracingExporterOTLP:
+	case TracingExporterFile:
+		if config.File == "" {
+			errs.Add("general.tracing.file", "spans file should be set for file exporter")
+		}
+	default:
+		errs.Add("general.tracing.exporter", "unknown tracing exporter %q, %s or %s expected",
+			config.Exporter, TracingExporterOTLP, TracingExporterFile)
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		errs.Add("general.tracing.sampleRatio", "should be between 0 and 1")
+	}
+	return errs
+}
@@ -0,0 +1,198 @@
+package qp
+
+import (
+	"fmt"
+	core "github.com/iVariable/qp/src/qp"
+	"github.com/iVariable/qp/src/resources"
+	"github.com/iVariable/qp/src/utils"
+	"strings"
+)
+
+// Validate checks configuration without connecting to anything: component types should be registered,
+// names should be unique, options should match option structs of the components and references
+// between strategies, queues, middleware and processors should point to configured components
+// and processors should not reference each other in a cycle.
+// All problems found are returned as one *utils.DecodeError
+func Validate(config *Config) error {
+	errs := &utils.DecodeError{}
+	names := map[string]map[string]bool{
+		"queue":      {},
+		"middleware": {},
+		"processor":  {},
+		"strategy":   {},
+	}
+	var references []utils.Reference
+
+	errs.Merge("", logConfigErrors(config.General.Log))
+	errs.Merge("", tracingConfigErrors(config.General.Tracing))
+	errs.Merge("", healthConfigErrors(config.General.Health))
+	if config.General.ShutdownTimeout < 0 {
+		errs.Add("general.shutdownTimeout", "should be >= 0")
+	}
+
+	for i, entry := range config.Queue {
+		path := fmt.Sprintf("queue[%d]", i)
+		validateName(path, entry.Name, names["queue"], errs)
+		if newQueue, ok := resources.AvailableQueues[entry.Type]; ok {
+			references = append(references, validateOptions(path+".options", newQueue(), entry.Options, errs)...)
+		} else {
+			errs.Add(path+".type", "unknown queue type %q", entry.Type)
+		}
+		for j, codec := range entry.Codecs {
+			codecPath := fmt.Sprintf("%s.codecs[%d]", path, j)
+			if newCodec, ok := resources.AvailableCodecs[codec.Type]; ok {
+				references = append(references, validateOptions(codecPath+".options", newCodec(), codec.Options, errs)...)
+			} else {
+				errs.Add(codecPath+".type", "unknown codec type %q", codec.Type)
+			}
+		}
+	}
+
+	for i, entry := range config.Middleware {
+		path := fmt.Sprintf("middleware[%d]", i)
+		validateName(path, entry.Name, names["middleware"], errs)
+		if newMiddleware, ok := resources.AvailableMiddleware[entry.Type]; ok {
+			references = append(references, validateOptions(path+".options", newMiddleware(), entry.Options, errs)...)
+		} else {
+			errs.Add(path+".type", "unknown middleware type %q", entry.Type)
+		}
+	}
+
+	for i, entry := range config.Processor {
+		path := fmt.Sprintf("processor[%d]", i)
+		validateName(path, entry.Name, names["processor"], errs)
+		if newProcessor, ok := resources.AvailableProcessors[entry.Type]; ok {
+			references = append(references, validateOptions(path+".options", newProcessor(), entry.Options, errs)...)
+		} else {
+			errs.Add(path+".type", "unknown processor type %q", entry.Type)
+		}
+	}
+
+	if len(config.Strategy) != 1 {
+		errs.Add("strategy", "there should be exactly one strategy configured, %d given", len(config.Strategy))
+	}
+	for i, entry := range config.Strategy {
+		path := fmt.Sprintf("strategy[%d]", i)
+		validateName(path, entry.Name, names["strategy"], errs)
+		newStrategy, ok := resources.AvailableStrategies[entry.Type]
+		if !ok {
+			errs.Add(path+".type", "unknown strategy type %q", entry.Type)
+			continue
+		}
+		// Name is injected by the loader, see loadStrategies
+		options := map[string]interface{}{"Name": entry.Name}
+		for k, v := range entry.Options {
+			options[k] = v
+		}
+		references = append(references, validateOptions(path+".options", newStrategy(), options, errs)...)
+	}
+
+	for _, reference := range references {
+		if !names[reference.Kind][reference.Name] {
+			errs.Add(reference.Path, "unknown %s %q", reference.Kind, reference.Name)
+		}
+	}
+	if cycle := processorCycle(config); cycle != nil {
+		errs.Add("processor", "processors reference each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	return errs.OrNil()
+}
+
+// processorCycle returns names of processors referencing each other in a cycle (e.g. Pipeline A -> B -> A),
+// nil if there is none. Processors of such cycle would pass the job to each other endlessly
+func processorCycle(config *Config) []string {
+	graph := make(map[string][]string)
+	var names []string
+	for _, entry := range config.Processor {
+		names = append(names, entry.Name)
+		newProcessor, ok := resources.AvailableProcessors[entry.Type]
+		if !ok {
+			continue
+		}
+		provider, ok := newProcessor().(core.IOptionsProvider)
+		if !ok {
+			continue
+		}
+		target := provider.Options()
+		// invalid options are reported by validateOptions, references found in them are still followed
+		utils.Decode(entry.Options, target)
+		for _, reference := range utils.References(target) {
+			if reference.Kind == "processor" {
+				graph[entry.Name] = append(graph[entry.Name], reference.Name)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, visitedName := range path {
+				if visitedName == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, next := range graph[name] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// validateName reports empty and duplicated component names
+func validateName(path string, name string, names map[string]bool, errs *utils.DecodeError) {
+	switch {
+	case name == "":
+		errs.Add(path+".name", "name should not be empty")
+	case names[name]:
+		errs.Add(path+".name", "duplicated name %q", name)
+	}
+	names[name] = true
+}
+
+// validateOptions decodes options of the component into its options struct and returns references found in them.
+// Options of components which do not describe them (no Options() method) are not checked, values of options
+// structs implementing IOptionsValidator are checked after decoding
+func validateOptions(path string, component interface{}, options map[string]interface{}, errs *utils.DecodeError) []utils.Reference {
+	provider, ok := component.(core.IOptionsProvider)
+	if !ok {
+		return nil
+	}
+	target := provider.Options()
+	if err := utils.Decode(options, target); err != nil {
+		errs.Merge(path, err)
+	} else if validator, ok := target.(core.IOptionsValidator); ok {
+		if err := validator.Validate(); err != nil {
+			errs.Merge(path, err)
+		}
+	}
+
+	references := utils.References(target)
+	for i := range references {
+		references[i].Path = utils.JoinPath(path, references[i].Path)
+	}
+	return references
+}